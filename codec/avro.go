@@ -0,0 +1,53 @@
+package codec
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hamba/avro/v2"
+	"reduction.dev/reduction-go/rxn"
+)
+
+// AvroCodec serializes values as Avro binary data with a schema. T is usually
+// a struct whose fields are tagged with their Avro field names, for instance
+// `avro:"user_id"`.
+type AvroCodec[T any] struct {
+	schema avro.Schema
+}
+
+// NewAvroCodec creates an [AvroCodec] from a JSON Avro schema.
+func NewAvroCodec[T any](schema string) (*AvroCodec[T], error) {
+	parsed, err := avro.Parse(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Avro schema: %w", err)
+	}
+	return &AvroCodec[T]{schema: parsed}, nil
+}
+
+// ReadAvroCodec creates an [AvroCodec] from the JSON Avro schema in a local
+// file, such as an .avsc file checked in next to the job.
+func ReadAvroCodec[T any](path string) (*AvroCodec[T], error) {
+	schema, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Avro schema: %w", err)
+	}
+	return NewAvroCodec[T](string(schema))
+}
+
+func (c *AvroCodec[T]) Encode(value T) ([]byte, error) {
+	b, err := avro.Marshal(c.schema, value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Avro: %w", err)
+	}
+	return b, nil
+}
+
+func (c *AvroCodec[T]) Decode(b []byte) (T, error) {
+	var value T
+	if err := avro.Unmarshal(c.schema, b, &value); err != nil {
+		return value, fmt.Errorf("failed to decode Avro: %w", err)
+	}
+	return value, nil
+}
+
+var _ rxn.ValueCodec[any] = (*AvroCodec[any])(nil)
@@ -0,0 +1,64 @@
+// The codec package provides generic codecs for storing values in state. Each
+// codec in this package satisfies [rxn.ValueCodec] and can be used as either
+// half of a [MapCodec].
+package codec
+
+import (
+	"reduction.dev/reduction-go/internal/states"
+	"reduction.dev/reduction-go/rxn"
+)
+
+// MapCodec is an [rxn.MapCodec] combining separate codecs for keys and values,
+// for instance a scalar key with a JSON value.
+type MapCodec[K comparable, V any] struct {
+	Key   rxn.ValueCodec[K]
+	Value rxn.ValueCodec[V]
+}
+
+// NewMapCodec creates a [MapCodec] from a key codec and a value codec.
+func NewMapCodec[K comparable, V any](key rxn.ValueCodec[K], value rxn.ValueCodec[V]) MapCodec[K, V] {
+	return MapCodec[K, V]{Key: key, Value: value}
+}
+
+func (c MapCodec[K, V]) EncodeKey(key K) ([]byte, error) {
+	return c.Key.Encode(key)
+}
+
+func (c MapCodec[K, V]) DecodeKey(b []byte) (K, error) {
+	return c.Key.Decode(b)
+}
+
+func (c MapCodec[K, V]) EncodeValue(value V) ([]byte, error) {
+	return c.Value.Encode(value)
+}
+
+func (c MapCodec[K, V]) DecodeValue(b []byte) (V, error) {
+	return c.Value.Decode(b)
+}
+
+// ValueNeedsUpgrade reports whether the value codec decoded data written in an
+// older format, for instance by a [Versioned] codec.
+func (c MapCodec[K, V]) ValueNeedsUpgrade(b []byte) bool {
+	upgradable, ok := c.Value.(states.UpgradableCodec)
+	return ok && upgradable.NeedsUpgrade(b)
+}
+
+// ScalarCodec uses Protobuf wrapper types to serialize simple scalar values.
+// See [rxn.ScalarMapCodec] for the supported types.
+type ScalarCodec[T states.ProtoScalar] struct{}
+
+func (ScalarCodec[T]) Encode(value T) ([]byte, error) {
+	return states.EncodeScalar(value)
+}
+
+func (ScalarCodec[T]) Decode(b []byte) (T, error) {
+	return states.DecodeScalar[T](b)
+}
+
+var (
+	_ rxn.MapCodec[string, int] = MapCodec[string, int]{}
+	_ rxn.ValueCodec[int]       = ScalarCodec[int]{}
+
+	_ states.UpgradableMapCodec = MapCodec[string, int]{}
+	_ states.UpgradableCodec    = (*Versioned[int])(nil)
+)
@@ -0,0 +1,112 @@
+package codec_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reduction.dev/reduction-go/codec"
+	"reduction.dev/reduction-go/rxn"
+)
+
+type user struct {
+	Name  string
+	Email string
+	Tags  []string
+}
+
+func TestJSONCodec(t *testing.T) {
+	roundTrip(t, codec.JSONCodec[user]{}, user{Name: "ada", Email: "ada@example.com", Tags: []string{"admin"}})
+
+	_, err := codec.JSONCodec[user]{}.Decode([]byte("{"))
+	assert.ErrorContains(t, err, "failed to decode JSON")
+}
+
+func TestGobCodec(t *testing.T) {
+	roundTrip(t, codec.GobCodec[user]{}, user{Name: "ada", Email: "ada@example.com", Tags: []string{"admin"}})
+
+	_, err := codec.GobCodec[user]{}.Decode([]byte("invalid"))
+	assert.ErrorContains(t, err, "failed to decode gob")
+}
+
+func TestProtoCodec(t *testing.T) {
+	value := timestamppb.New(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	b, err := codec.ProtoCodec[*timestamppb.Timestamp]{}.Encode(value)
+	require.NoError(t, err)
+	decoded, err := codec.ProtoCodec[*timestamppb.Timestamp]{}.Decode(b)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(value, decoded), "decoded message should equal the original")
+
+	_, err = codec.ProtoCodec[*timestamppb.Timestamp]{}.Decode([]byte{0xff})
+	assert.ErrorContains(t, err, "failed to decode proto")
+}
+
+func TestMapCodec_ScalarKeyJSONValue(t *testing.T) {
+	var mapCodec rxn.MapCodec[string, user] = codec.NewMapCodec(codec.ScalarCodec[string]{}, codec.JSONCodec[user]{})
+
+	keyBytes, err := mapCodec.EncodeKey("user-1")
+	require.NoError(t, err)
+	key, err := mapCodec.DecodeKey(keyBytes)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", key)
+
+	valueBytes, err := mapCodec.EncodeValue(user{Name: "ada"})
+	require.NoError(t, err)
+	value, err := mapCodec.DecodeValue(valueBytes)
+	require.NoError(t, err)
+	assert.Equal(t, user{Name: "ada"}, value)
+}
+
+type avroUser struct {
+	Name  string   `avro:"name"`
+	Email string   `avro:"email"`
+	Tags  []string `avro:"tags"`
+}
+
+const avroUserSchema = `{
+	"type": "record",
+	"name": "User",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "email", "type": "string"},
+		{"name": "tags", "type": {"type": "array", "items": "string"}}
+	]
+}`
+
+func TestAvroCodec(t *testing.T) {
+	c, err := codec.NewAvroCodec[avroUser](avroUserSchema)
+	require.NoError(t, err)
+	roundTrip[avroUser](t, c, avroUser{Name: "ada", Email: "ada@example.com", Tags: []string{"admin"}})
+
+	_, err = c.Decode([]byte{0x02})
+	assert.ErrorContains(t, err, "failed to decode Avro")
+
+	_, err = codec.NewAvroCodec[avroUser](`{"type": "record"}`)
+	assert.ErrorContains(t, err, "failed to parse Avro schema")
+}
+
+func TestReadAvroCodec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "user.avsc")
+	require.NoError(t, os.WriteFile(path, []byte(avroUserSchema), 0o644))
+
+	c, err := codec.ReadAvroCodec[avroUser](path)
+	require.NoError(t, err)
+	roundTrip[avroUser](t, c, avroUser{Name: "ada", Email: "ada@example.com"})
+
+	_, err = codec.ReadAvroCodec[avroUser](filepath.Join(t.TempDir(), "missing.avsc"))
+	assert.ErrorContains(t, err, "failed to read Avro schema")
+}
+
+func roundTrip[T any](t *testing.T, c rxn.ValueCodec[T], value T) {
+	t.Helper()
+	b, err := c.Encode(value)
+	require.NoError(t, err, "encoding should not error")
+	decoded, err := c.Decode(b)
+	require.NoError(t, err, "decoding should not error")
+	assert.Equal(t, value, decoded)
+}
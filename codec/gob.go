@@ -0,0 +1,33 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"reduction.dev/reduction-go/rxn"
+)
+
+// GobCodec serializes values with encoding/gob. Each value is encoded with its
+// own type information, which makes gob convenient for arbitrary Go types but
+// larger than JSON or Protobuf for small values. Gob encodes Go maps in random
+// order so don't use GobCodec for keys containing maps.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(value T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, fmt.Errorf("failed to encode gob: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Decode(b []byte) (T, error) {
+	var value T
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&value); err != nil {
+		return value, fmt.Errorf("failed to decode gob: %w", err)
+	}
+	return value, nil
+}
+
+var _ rxn.ValueCodec[any] = GobCodec[any]{}
@@ -0,0 +1,29 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"reduction.dev/reduction-go/rxn"
+)
+
+// JSONCodec serializes values with encoding/json.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(value T) ([]byte, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return b, nil
+}
+
+func (JSONCodec[T]) Decode(b []byte) (T, error) {
+	var value T
+	if err := json.Unmarshal(b, &value); err != nil {
+		return value, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	return value, nil
+}
+
+var _ rxn.ValueCodec[any] = JSONCodec[any]{}
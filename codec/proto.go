@@ -0,0 +1,29 @@
+package codec
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtoCodec serializes Protobuf messages. T is a generated message pointer
+// type such as *mypb.Event. Encoding is deterministic so messages can be used
+// as map keys.
+type ProtoCodec[T proto.Message] struct{}
+
+func (ProtoCodec[T]) Encode(value T) ([]byte, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode proto: %w", err)
+	}
+	return b, nil
+}
+
+func (ProtoCodec[T]) Decode(b []byte) (T, error) {
+	var zero T
+	value := zero.ProtoReflect().Type().New().Interface().(T)
+	if err := proto.Unmarshal(b, value); err != nil {
+		return zero, fmt.Errorf("failed to decode proto: %w", err)
+	}
+	return value, nil
+}
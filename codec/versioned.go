@@ -0,0 +1,130 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+
+	"reduction.dev/reduction-go/rxn"
+)
+
+// Versioned wraps a codec to prefix encoded values with a schema version. When
+// the type stored in state changes, bump the version and register a migration
+// that decodes data written with the previous version into the new type:
+//
+//	codec := codec.NewVersioned(2, codec.JSONCodec[UserV2]{}).
+//		Migrate(1, func(b []byte) (UserV2, error) {
+//			v1, err := codec.JSONCodec[UserV1]{}.Decode(b)
+//			return UserV2{Name: v1.Name}, err
+//		})
+//
+// State loaded from an older version is migrated as it's decoded and written
+// back in the current version with the state's next mutations.
+//
+// Versioned values start with a marker before the version so that data
+// written before adopting Versioned isn't mistaken for a version. Register
+// [Versioned.MigrateUnversioned] to decode that data; without it, unversioned
+// data fails to decode.
+type Versioned[T any] struct {
+	version     uint64
+	codec       rxn.ValueCodec[T]
+	migrations  map[uint64]func([]byte) (T, error)
+	unversioned func([]byte) (T, error)
+}
+
+// versionMarker starts every value written by a Versioned codec. 0xff can't
+// start JSON or UTF-8 text and is an unusual first byte for Protobuf.
+var versionMarker = []byte{0xff, 'r', 'v'}
+
+// NewVersioned creates a [Versioned] codec that encodes values as the given
+// schema version using codec.
+func NewVersioned[T any](version uint64, codec rxn.ValueCodec[T]) *Versioned[T] {
+	return &Versioned[T]{
+		version:    version,
+		codec:      codec,
+		migrations: make(map[uint64]func([]byte) (T, error)),
+	}
+}
+
+// Migrate registers a function that decodes data written with an older schema
+// version into the current type. The function receives the data without its
+// version prefix.
+func (c *Versioned[T]) Migrate(from uint64, decode func([]byte) (T, error)) *Versioned[T] {
+	if from == c.version {
+		panic(fmt.Sprintf("cannot register a migration from the current schema version %d", from))
+	}
+	c.migrations[from] = decode
+	return c
+}
+
+// MigrateUnversioned registers a function that decodes data written without
+// a Versioned codec, for instance state in savepoints from before the codec
+// was adopted. The function receives the data as stored.
+func (c *Versioned[T]) MigrateUnversioned(decode func([]byte) (T, error)) *Versioned[T] {
+	c.unversioned = decode
+	return c
+}
+
+func (c *Versioned[T]) Encode(value T) ([]byte, error) {
+	data, err := c.codec.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	prefix := binary.AppendUvarint(slices.Clone(versionMarker), c.version)
+	return append(prefix, data...), nil
+}
+
+func (c *Versioned[T]) Decode(b []byte) (T, error) {
+	var zero T
+	if !bytes.HasPrefix(b, versionMarker) {
+		if c.unversioned == nil {
+			return zero, fmt.Errorf("missing schema version marker, register MigrateUnversioned to decode data written without a Versioned codec")
+		}
+		value, err := c.unversioned(b)
+		if err != nil {
+			return zero, fmt.Errorf("failed to migrate unversioned data to schema version %d: %w", c.version, err)
+		}
+		return value, nil
+	}
+
+	version, data, err := splitVersion(b)
+	if err != nil {
+		return zero, err
+	}
+	if version == c.version {
+		return c.codec.Decode(data)
+	}
+
+	migrate, ok := c.migrations[version]
+	if !ok {
+		return zero, fmt.Errorf("no migration from schema version %d to %d", version, c.version)
+	}
+	value, err := migrate(data)
+	if err != nil {
+		return zero, fmt.Errorf("failed to migrate from schema version %d to %d: %w", version, c.version, err)
+	}
+	return value, nil
+}
+
+// NeedsUpgrade reports whether the data was written with an older schema
+// version or without a Versioned codec.
+func (c *Versioned[T]) NeedsUpgrade(b []byte) bool {
+	if !bytes.HasPrefix(b, versionMarker) {
+		return true
+	}
+	version, _, err := splitVersion(b)
+	return err == nil && version != c.version
+}
+
+// splitVersion returns the version and data of a value that starts with the
+// version marker.
+func splitVersion(b []byte) (uint64, []byte, error) {
+	version, n := binary.Uvarint(b[len(versionMarker):])
+	if n <= 0 {
+		return 0, nil, fmt.Errorf("missing schema version after marker")
+	}
+	return version, b[len(versionMarker)+n:], nil
+}
+
+var _ rxn.ValueCodec[int] = (*Versioned[int])(nil)
@@ -0,0 +1,145 @@
+package codec_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reduction.dev/reduction-go/codec"
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/internal/states"
+)
+
+type userV1 struct {
+	Name string
+}
+
+type userV2 struct {
+	FirstName string
+	LastName  string
+}
+
+var userV1Codec = codec.NewVersioned(1, codec.JSONCodec[userV1]{})
+
+func userV2Codec() *codec.Versioned[userV2] {
+	return codec.NewVersioned(2, codec.JSONCodec[userV2]{}).
+		Migrate(1, func(b []byte) (userV2, error) {
+			v1, err := codec.JSONCodec[userV1]{}.Decode(b)
+			return userV2{FirstName: v1.Name}, err
+		})
+}
+
+func TestVersioned_RoundTrip(t *testing.T) {
+	roundTrip(t, userV2Codec(), userV2{FirstName: "Ada", LastName: "Lovelace"})
+}
+
+func TestVersioned_MigratesOlderVersion(t *testing.T) {
+	v1Data, err := userV1Codec.Encode(userV1{Name: "Ada"})
+	require.NoError(t, err)
+
+	c := userV2Codec()
+	assert.True(t, c.NeedsUpgrade(v1Data), "v1 data should need an upgrade")
+	value, err := c.Decode(v1Data)
+	require.NoError(t, err)
+	assert.Equal(t, userV2{FirstName: "Ada"}, value)
+
+	v2Data, err := c.Encode(value)
+	require.NoError(t, err)
+	assert.False(t, c.NeedsUpgrade(v2Data), "v2 data should not need an upgrade")
+}
+
+func TestVersioned_ErrorsWithoutMigration(t *testing.T) {
+	v1Data, err := userV1Codec.Encode(userV1{Name: "Ada"})
+	require.NoError(t, err)
+
+	_, err = codec.NewVersioned(2, codec.JSONCodec[userV2]{}).Decode(v1Data)
+	assert.ErrorContains(t, err, "no migration from schema version 1 to 2")
+
+	_, err = userV1Codec.Decode([]byte{0xff, 'r', 'v'})
+	assert.ErrorContains(t, err, "missing schema version after marker")
+}
+
+func TestVersioned_UnversionedData(t *testing.T) {
+	// JSON starts with '{', which would read as version 123 without a marker
+	legacy, err := codec.JSONCodec[userV1]{}.Encode(userV1{Name: "Ada"})
+	require.NoError(t, err)
+
+	c := userV2Codec()
+	assert.True(t, c.NeedsUpgrade(legacy), "unversioned data should need an upgrade")
+	_, err = c.Decode(legacy)
+	assert.ErrorContains(t, err, "missing schema version marker")
+
+	c.MigrateUnversioned(func(b []byte) (userV2, error) {
+		v1, err := codec.JSONCodec[userV1]{}.Decode(b)
+		return userV2{FirstName: v1.Name}, err
+	})
+	value, err := c.Decode(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, userV2{FirstName: "Ada"}, value)
+
+	_, err = c.Decode([]byte("not json"))
+	assert.ErrorContains(t, err, "failed to migrate unversioned data to schema version 2")
+}
+
+func TestVersioned_ValueStateRewritesUnversionedValue(t *testing.T) {
+	legacy, err := codec.ScalarCodec[int]{}.Encode(8)
+	require.NoError(t, err)
+
+	c := codec.NewVersioned(1, codec.ScalarCodec[int]{}).MigrateUnversioned(codec.ScalarCodec[int]{}.Decode)
+	state := states.NewValueState("count", c)
+	require.NoError(t, state.Load([]internal.StateEntry{{Key: []byte("count"), Value: legacy}}))
+	assert.Equal(t, 8, state.Value())
+
+	mutations, err := state.Mutations()
+	require.NoError(t, err)
+	require.Len(t, mutations, 1, "unversioned value should be written back")
+	assert.Equal(t, mustEncode(t, c, 8), mutations[0].(*internal.PutMutation).Value)
+}
+
+func TestVersioned_ValueStateRewritesMigratedValue(t *testing.T) {
+	v1Data, err := userV1Codec.Encode(userV1{Name: "Ada"})
+	require.NoError(t, err)
+
+	state := states.NewValueState("user", userV2Codec())
+	require.NoError(t, state.Load([]internal.StateEntry{{Key: []byte("user"), Value: v1Data}}))
+	assert.Equal(t, userV2{FirstName: "Ada"}, state.Value())
+
+	mutations, err := state.Mutations()
+	require.NoError(t, err)
+	require.Len(t, mutations, 1, "migrated value should be written back")
+	put := mutations[0].(*internal.PutMutation)
+	assert.False(t, userV2Codec().NeedsUpgrade(put.Value), "value should be written in the current version")
+}
+
+func TestVersioned_MapStateRewritesMigratedValues(t *testing.T) {
+	v1Data, err := userV1Codec.Encode(userV1{Name: "Ada"})
+	require.NoError(t, err)
+	v2Data, err := userV2Codec().Encode(userV2{FirstName: "Grace"})
+	require.NoError(t, err)
+
+	mapCodec := codec.NewMapCodec(codec.ScalarCodec[string]{}, userV2Codec())
+	oldKey, err := mapCodec.EncodeKey("old")
+	require.NoError(t, err)
+	newKey, err := mapCodec.EncodeKey("new")
+	require.NoError(t, err)
+
+	state := states.NewMapState("users", mapCodec)
+	require.NoError(t, state.Load([]internal.StateEntry{
+		{Key: oldKey, Value: v1Data},
+		{Key: newKey, Value: v2Data},
+	}))
+	assert.Equal(t, 2, state.Size())
+
+	mutations, err := state.Mutations()
+	require.NoError(t, err)
+	assert.Equal(t, []internal.StateMutation{
+		&internal.PutMutation{Key: oldKey, Value: mustEncode(t, userV2Codec(), userV2{FirstName: "Ada"})},
+	}, mutations, "only the migrated value should be written back")
+}
+
+func mustEncode[T any](t *testing.T, c interface{ Encode(T) ([]byte, error) }, value T) []byte {
+	t.Helper()
+	b, err := c.Encode(value)
+	require.NoError(t, err)
+	return b
+}
@@ -53,7 +53,8 @@ func (s *Sink) Collect(ctx context.Context, value *SinkRecord) {
 
 	payload, err := json.Marshal(value)
 	if err != nil {
-		panic(fmt.Sprintf("httpapi Sink json.Marshal: %v", err))
+		subject.Fail(&internal.SinkError{Key: subject.Key(), SinkID: s.id, Err: fmt.Errorf("failed to marshal record: %w", err)})
+		return
 	}
 	subject.AddSinkRequest(s.id, payload)
 }
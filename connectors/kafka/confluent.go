@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"reduction.dev/reduction-go/rxn"
+)
+
+// confluentMagicByte starts every value in the Confluent wire format.
+const confluentMagicByte = 0
+
+// ConfluentCodec frames values in the Confluent Schema Registry wire format: a
+// zero byte, the 4-byte big-endian schema ID, and then the value encoded by the
+// wrapped codec. Rather than querying a registry, the codec uses a single
+// schema known ahead of time, for instance from a local schema file, and
+// rejects values framed with any other schema ID.
+type ConfluentCodec[T any] struct {
+	SchemaID uint32
+	Codec    rxn.ValueCodec[T]
+}
+
+// NewConfluentCodec creates a [ConfluentCodec] for values written with the
+// schema ID and encoded by codec.
+func NewConfluentCodec[T any](schemaID uint32, codec rxn.ValueCodec[T]) ConfluentCodec[T] {
+	return ConfluentCodec[T]{SchemaID: schemaID, Codec: codec}
+}
+
+func (c ConfluentCodec[T]) Encode(value T) ([]byte, error) {
+	payload, err := c.Codec.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 5, 5+len(payload))
+	b[0] = confluentMagicByte
+	binary.BigEndian.PutUint32(b[1:5], c.SchemaID)
+	return append(b, payload...), nil
+}
+
+func (c ConfluentCodec[T]) Decode(b []byte) (T, error) {
+	var zero T
+	if len(b) < 5 || b[0] != confluentMagicByte {
+		return zero, fmt.Errorf("value is not in the Confluent wire format")
+	}
+	if id := binary.BigEndian.Uint32(b[1:5]); id != c.SchemaID {
+		return zero, fmt.Errorf("value has schema ID %d but codec expects %d", id, c.SchemaID)
+	}
+	return c.Codec.Decode(b[5:])
+}
+
+var _ rxn.ValueCodec[any] = ConfluentCodec[any]{}
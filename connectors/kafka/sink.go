@@ -11,18 +11,22 @@ import (
 )
 
 type Sink struct {
-	id      string
-	brokers topology.ResolvableString
+	id           string
+	brokers      topology.ResolvableString
+	defaultTopic string
 }
 
 type SinkParams struct {
 	Brokers topology.ResolvableString
+	// The topic for records collected without a Topic.
+	DefaultTopic string
 }
 
 func NewSink(job *topology.Job, id string, params *SinkParams) *Sink {
 	sink := &Sink{
-		id:      id,
-		brokers: params.Brokers,
+		id:           id,
+		brokers:      params.Brokers,
+		defaultTopic: params.DefaultTopic,
 	}
 	topology.InternalAccess(job).RegisterSink(sink)
 	return sink
@@ -42,11 +46,21 @@ func (s *Sink) Synthesize() internal.SinkSynthesis {
 }
 
 func (s *Sink) Collect(ctx context.Context, record *Record) {
-	payload, err := proto.Marshal(record.proto())
-	if err != nil {
-		panic(fmt.Errorf("failed to marshal record: %v", err))
+	subject := internal.SubjectFromContext(ctx)
+
+	pbRecord := record.proto()
+	if pbRecord.Topic == "" {
+		pbRecord.Topic = s.defaultTopic
+	}
+	if pbRecord.Topic == "" {
+		subject.Fail(&internal.SinkError{Key: subject.Key(), SinkID: s.id, Err: fmt.Errorf("record has no topic and the sink has no default topic")})
+		return
 	}
 
-	subject := internal.SubjectFromContext(ctx)
+	payload, err := proto.Marshal(pbRecord)
+	if err != nil {
+		subject.Fail(&internal.SinkError{Key: subject.Key(), SinkID: s.id, Err: fmt.Errorf("failed to marshal record: %w", err)})
+		return
+	}
 	subject.AddSinkRequest(s.id, payload)
 }
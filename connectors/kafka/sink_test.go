@@ -1,12 +1,20 @@
 package kafka_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"reduction.dev/reduction-go/connectors/embedded"
 	"reduction.dev/reduction-go/connectors/kafka"
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/rxn"
 	"reduction.dev/reduction-go/topology"
 	"reduction.dev/reduction-protocol/jobconfigpb"
+	"reduction.dev/reduction-protocol/kafkapb"
 )
 
 func TestSinkSynthesize(t *testing.T) {
@@ -25,3 +33,61 @@ func TestSinkSynthesize(t *testing.T) {
 		},
 	}, synth.Config)
 }
+
+func TestSinkCollect_DefaultTopic(t *testing.T) {
+	job := &topology.Job{}
+	sink := kafka.NewSink(job, "sink", &kafka.SinkParams{
+		Brokers:      topology.StringValue("broker1"),
+		DefaultTopic: "default-topic",
+	})
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{
+		KeyEvent: func(ctx context.Context, record []byte) ([]internal.KeyedEvent, error) {
+			return []internal.KeyedEvent{{Key: []byte("key"), Value: record}}, nil
+		},
+	})
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			return &topicHandler{sink: sink}
+		},
+	})
+	source.Connect(operator)
+	operator.Connect(sink)
+
+	tr := job.NewTestRun()
+	tr.AddRecord([]byte("record-topic"))
+	tr.AddRecord([]byte(""))
+	require.NoError(t, tr.RunLocal())
+
+	var topics []string
+	for _, value := range tr.SinkValues("sink") {
+		var record kafkapb.Record
+		require.NoError(t, proto.Unmarshal(value, &record))
+		topics = append(topics, record.Topic)
+	}
+	assert.Equal(t, []string{"record-topic", "default-topic"}, topics)
+}
+
+func TestSinkCollect_MissingTopic(t *testing.T) {
+	job := &topology.Job{}
+	sink := kafka.NewSink(job, "sink", &kafka.SinkParams{
+		Brokers: topology.StringValue("broker1"),
+	})
+
+	subject := internal.NewSubject([]byte("key"), nil, time.Time{}, time.Time{}, time.Time{})
+	sink.Collect(internal.ContextWithSubject(context.Background(), subject), &kafka.Record{Value: []byte("value")})
+	assert.ErrorContains(t, subject.Err(), "record has no topic")
+}
+
+// topicHandler collects a record to the topic named by each event's value.
+type topicHandler struct {
+	sink *kafka.Sink
+}
+
+func (h *topicHandler) OnEvent(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+	h.sink.Collect(ctx, &kafka.Record{Topic: string(event.Value), Value: []byte("value")})
+	return nil
+}
+
+func (h *topicHandler) OnTimerExpired(ctx context.Context, subject rxn.Subject, timer time.Time) error {
+	return nil
+}
@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/rxn"
+	"reduction.dev/reduction-go/topology"
+)
+
+// TypedRecord is a Kafka record with a value decoded by a typed source or
+// encoded by a typed sink.
+type TypedRecord[T any] struct {
+	Topic     string
+	Partition int
+	Key       []byte
+	Value     T
+	Headers   []Header
+	Timestamp time.Time
+}
+
+type TypedSourceParams[T any] struct {
+	ConsumerGroup topology.ResolvableString
+	Brokers       topology.ResolvableString
+	Topics        topology.ResolvableString
+	// Decodes record values, for instance a codec.JSONCodec or a
+	// [ConfluentCodec] wrapping a codec.AvroCodec.
+	Codec    rxn.ValueCodec[T]
+	KeyEvent func(ctx context.Context, record *TypedRecord[T]) ([]internal.KeyedEvent, error)
+}
+
+// NewTypedSource creates a Kafka source that decodes each record's value with
+// the codec before passing the record to KeyEvent. Records that fail to decode
+// are rejected as bad input.
+func NewTypedSource[T any](job *topology.Job, id string, params *TypedSourceParams[T]) *Source {
+	return NewSource(job, id, &SourceParams{
+		ConsumerGroup: params.ConsumerGroup,
+		Brokers:       params.Brokers,
+		Topics:        params.Topics,
+		KeyEvent: func(ctx context.Context, record *Record) ([]internal.KeyedEvent, error) {
+			value, err := params.Codec.Decode(record.Value)
+			if err != nil {
+				return nil, internal.NewBadInputError(fmt.Errorf("failed to decode record value: %w", err))
+			}
+			return params.KeyEvent(ctx, &TypedRecord[T]{
+				Topic:     record.Topic,
+				Partition: record.Partition,
+				Key:       record.Key,
+				Value:     value,
+				Headers:   record.Headers,
+				Timestamp: record.Timestamp,
+			})
+		},
+	})
+}
+
+// TypedSink is a Kafka sink that encodes record values with a codec.
+type TypedSink[T any] struct {
+	sink  *Sink
+	codec rxn.ValueCodec[T]
+}
+
+type TypedSinkParams[T any] struct {
+	Brokers topology.ResolvableString
+	// The topic for records collected without a Topic.
+	DefaultTopic string
+	// Encodes record values
+	Codec rxn.ValueCodec[T]
+}
+
+func NewTypedSink[T any](job *topology.Job, id string, params *TypedSinkParams[T]) *TypedSink[T] {
+	return &TypedSink[T]{
+		sink: NewSink(job, id, &SinkParams{
+			Brokers:      params.Brokers,
+			DefaultTopic: params.DefaultTopic,
+		}),
+		codec: params.Codec,
+	}
+}
+
+func (s *TypedSink[T]) Synthesize() internal.SinkSynthesis {
+	return s.sink.Synthesize()
+}
+
+func (s *TypedSink[T]) Collect(ctx context.Context, record *TypedRecord[T]) {
+	value, err := s.codec.Encode(record.Value)
+	if err != nil {
+		subject := internal.SubjectFromContext(ctx)
+		subject.Fail(&internal.SinkError{Key: subject.Key(), SinkID: s.sink.id, Err: fmt.Errorf("failed to encode record value: %w", err)})
+		return
+	}
+	s.sink.Collect(ctx, &Record{
+		Topic:     record.Topic,
+		Partition: record.Partition,
+		Key:       record.Key,
+		Value:     value,
+		Headers:   record.Headers,
+		Timestamp: record.Timestamp,
+	})
+}
+
+var _ rxn.Sink[*TypedRecord[any]] = (*TypedSink[any])(nil)
@@ -0,0 +1,156 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"reduction.dev/reduction-go/codec"
+	"reduction.dev/reduction-go/connectors/embedded"
+	"reduction.dev/reduction-go/connectors/kafka"
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/rxn"
+	"reduction.dev/reduction-go/topology"
+	"reduction.dev/reduction-protocol/kafkapb"
+)
+
+type click struct {
+	UserID string `avro:"user_id" json:"user_id"`
+	Count  int    `avro:"count" json:"count"`
+}
+
+const clickSchema = `{
+	"type": "record",
+	"name": "Click",
+	"fields": [
+		{"name": "user_id", "type": "string"},
+		{"name": "count", "type": "int"}
+	]
+}`
+
+func TestConfluentCodec(t *testing.T) {
+	avroCodec, err := codec.NewAvroCodec[click](clickSchema)
+	require.NoError(t, err)
+	c := kafka.NewConfluentCodec[click](42, avroCodec)
+
+	b, err := c.Encode(click{UserID: "u1", Count: 3})
+	require.NoError(t, err)
+	assert.Equal(t, byte(0), b[0], "magic byte")
+	assert.Equal(t, uint32(42), binary.BigEndian.Uint32(b[1:5]), "schema ID")
+
+	decoded, err := c.Decode(b)
+	require.NoError(t, err)
+	assert.Equal(t, click{UserID: "u1", Count: 3}, decoded)
+
+	_, err = kafka.NewConfluentCodec[click](7, avroCodec).Decode(b)
+	assert.ErrorContains(t, err, "value has schema ID 42 but codec expects 7")
+
+	_, err = c.Decode([]byte("{}"))
+	assert.ErrorContains(t, err, "not in the Confluent wire format")
+}
+
+func TestTypedSource_KeyEventFunc(t *testing.T) {
+	avroCodec, err := codec.NewAvroCodec[click](clickSchema)
+	require.NoError(t, err)
+	valueCodec := kafka.NewConfluentCodec[click](1, avroCodec)
+
+	var typedRecord *kafka.TypedRecord[click]
+	source := kafka.NewTypedSource(&topology.Job{}, "test-source", &kafka.TypedSourceParams[click]{
+		ConsumerGroup: topology.StringValue("test-group"),
+		Brokers:       topology.StringValue("localhost:9092"),
+		Topics:        topology.StringValueList("clicks"),
+		Codec:         valueCodec,
+		KeyEvent: func(ctx context.Context, record *kafka.TypedRecord[click]) ([]internal.KeyedEvent, error) {
+			typedRecord = record
+			return nil, nil
+		},
+	})
+
+	value, err := valueCodec.Encode(click{UserID: "u1", Count: 3})
+	require.NoError(t, err)
+	data, err := proto.Marshal(&kafkapb.Record{Key: []byte("u1"), Value: value, Topic: "clicks"})
+	require.NoError(t, err)
+
+	_, err = source.Synthesize().KeyEventFunc(context.Background(), data)
+	require.NoError(t, err)
+	assert.Equal(t, "clicks", typedRecord.Topic)
+	assert.Equal(t, []byte("u1"), typedRecord.Key)
+	assert.Equal(t, click{UserID: "u1", Count: 3}, typedRecord.Value)
+
+	data, err = proto.Marshal(&kafkapb.Record{Value: []byte("not avro")})
+	require.NoError(t, err)
+	_, err = source.Synthesize().KeyEventFunc(context.Background(), data)
+	assert.ErrorContains(t, err, "failed to decode record value")
+	assert.Equal(t, internal.ErrorKindBadInput, internal.ErrorKindOf(err))
+}
+
+func TestTypedSource_KeyEventFuncKeepsDecodeErrorChain(t *testing.T) {
+	source := kafka.NewTypedSource(&topology.Job{}, "test-source", &kafka.TypedSourceParams[click]{
+		Codec: codec.JSONCodec[click]{},
+		KeyEvent: func(ctx context.Context, record *kafka.TypedRecord[click]) ([]internal.KeyedEvent, error) {
+			return nil, nil
+		},
+	})
+
+	data, err := proto.Marshal(&kafkapb.Record{Value: []byte("not json")})
+	require.NoError(t, err)
+	_, err = source.Synthesize().KeyEventFunc(context.Background(), data)
+	var syntaxErr *json.SyntaxError
+	assert.ErrorAs(t, err, &syntaxErr, "the codec's error should be in the chain")
+	assert.Equal(t, internal.ErrorKindBadInput, internal.ErrorKindOf(err))
+}
+
+func TestTypedSink_Collect(t *testing.T) {
+	job := &topology.Job{}
+	sink := kafka.NewTypedSink(job, "sink", &kafka.TypedSinkParams[click]{
+		Brokers:      topology.StringValue("broker1"),
+		DefaultTopic: "clicks",
+		Codec:        codec.JSONCodec[click]{},
+	})
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{
+		KeyEvent: func(ctx context.Context, record []byte) ([]internal.KeyedEvent, error) {
+			return []internal.KeyedEvent{{Key: record}}, nil
+		},
+	})
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			return &clickHandler{sink: sink}
+		},
+	})
+	source.Connect(operator)
+	operator.Connect(sink)
+
+	tr := job.NewTestRun()
+	tr.AddRecord([]byte("u1"))
+	require.NoError(t, tr.RunLocal())
+
+	values := tr.SinkValues("sink")
+	require.Len(t, values, 1)
+	var record kafkapb.Record
+	require.NoError(t, proto.Unmarshal(values[0], &record))
+	assert.Equal(t, "clicks", record.Topic)
+	assert.Equal(t, []byte("u1"), record.Key)
+	assert.JSONEq(t, `{"user_id": "u1", "count": 1}`, string(record.Value))
+}
+
+// clickHandler collects one click for each event's key.
+type clickHandler struct {
+	sink *kafka.TypedSink[click]
+}
+
+func (h *clickHandler) OnEvent(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+	h.sink.Collect(ctx, &kafka.TypedRecord[click]{
+		Key:   subject.Key(),
+		Value: click{UserID: string(subject.Key()), Count: 1},
+	})
+	return nil
+}
+
+func (h *clickHandler) OnTimerExpired(ctx context.Context, subject rxn.Subject, timer time.Time) error {
+	return nil
+}
@@ -2,6 +2,7 @@ package memory
 
 import (
 	"context"
+	"sync"
 
 	"reduction.dev/reduction-go/internal"
 	"reduction.dev/reduction-go/topology"
@@ -11,6 +12,7 @@ import (
 type Sink[T any] struct {
 	ID      string
 	Records []T
+	mu      sync.Mutex
 }
 
 func NewSink[T any](job *topology.Job, id string) *Sink[T] {
@@ -34,5 +36,7 @@ func (s *Sink[T]) Synthesize() internal.SinkSynthesis {
 }
 
 func (s *Sink[T]) Collect(ctx context.Context, event T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.Records = append(s.Records, event)
 }
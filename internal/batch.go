@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"reduction.dev/reduction-protocol/handlerpb"
+)
+
+// Batch describes the events in a ProcessEventBatch request.
+type Batch struct {
+	// The distinct keys of events and timers in the order they first appear
+	Keys [][]byte
+	// The keyed events in the batch, excluding expired timers
+	Events []KeyedEvent
+	// The watermark for the batch
+	Watermark time.Time
+}
+
+// BatchHooks are called before and after each batch's events are processed.
+type BatchHooks interface {
+	OnBatchStart(ctx context.Context, batch Batch) error
+	OnBatchEnd(ctx context.Context, batch Batch) error
+}
+
+func newBatch(req *handlerpb.ProcessEventBatchRequest) Batch {
+	batch := Batch{Watermark: req.Watermark.AsTime()}
+	seen := make(map[string]bool)
+	for _, event := range req.Events {
+		key, _ := eventKey(event)
+		if bytes.Equal(key, deadLetterKey) {
+			continue
+		}
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			batch.Keys = append(batch.Keys, key)
+		}
+		if keyedEvent := event.GetKeyedEvent(); keyedEvent != nil {
+			batch.Events = append(batch.Events, KeyedEvent{
+				Key:       keyedEvent.Key,
+				Timestamp: keyedEvent.Timestamp.AsTime(),
+				Value:     keyedEvent.Value,
+			})
+		}
+	}
+	return batch
+}
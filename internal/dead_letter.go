@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// deadLetterKey is the reserved key for events that carry a source record
+// that failed in KeyEvent. KeyEvent responses can't write to sinks so the
+// record is forwarded to ProcessEventBatch to be handled there. All failed
+// records go to this one key, so a source with many failures concentrates
+// them on one key group.
+var deadLetterKey = []byte("\x00rxn.dead-letter")
+
+// DeadLetter describes an event or source record that failed processing.
+type DeadLetter struct {
+	// The source record when KeyEvent failed or the event value when OnEvent
+	// failed.
+	Record []byte
+	// The event's key. Empty when KeyEvent failed.
+	Key []byte
+	// The event's timestamp. When KeyEvent failed, the latest timestamp of the
+	// events keyed in the same batch, or the zero time if there were none.
+	Timestamp time.Time
+	// The message of the error returned by KeyEvent or OnEvent.
+	Error string
+}
+
+// DeadLetterHandler receives failed events instead of failing their batch. The
+// context carries a subject so that the handler can collect the dead letter
+// with a sink.
+type DeadLetterHandler = func(ctx context.Context, subject *Subject, letter DeadLetter)
+
+// newDeadLetterEvent creates the event that forwards a record that failed in
+// KeyEvent. The record has no event time of its own and the engine advances
+// the watermark with the timestamps that KeyEvent returns, so the event takes
+// a timestamp from the batch's other events rather than the wall clock, which
+// would move the watermark ahead of the stream.
+func newDeadLetterEvent(record []byte, timestamp time.Time, keyErr error) (KeyedEvent, error) {
+	value, err := json.Marshal(DeadLetter{Record: record, Timestamp: timestamp, Error: ErrorMessage(keyErr)})
+	if err != nil {
+		return KeyedEvent{}, err
+	}
+	return KeyedEvent{Key: deadLetterKey, Timestamp: timestamp, Value: value}, nil
+}
@@ -1,24 +1,65 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 )
 
+// ErrorKind classifies errors so that the engine can decide whether to retry,
+// skip, or quarantine the work that failed.
+type ErrorKind int
+
+const (
+	// An unexpected failure in the SDK.
+	ErrorKindInternal ErrorKind = iota
+	// The request or a source record can't be processed.
+	ErrorKindBadInput
+	// A transient failure where retrying may succeed.
+	ErrorKindRetryable
+	// A key's stored state can't be decoded or encoded.
+	ErrorKindStateCorruption
+	// A handler returned an error or panicked.
+	ErrorKindUser
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindBadInput:
+		return "bad_input"
+	case ErrorKindRetryable:
+		return "retryable"
+	case ErrorKindStateCorruption:
+		return "state_corruption"
+	case ErrorKindUser:
+		return "user"
+	default:
+		return "internal"
+	}
+}
+
 // Error represents an error with an associated HTTP status code.
 type Error struct {
 	StatusCode int
+	Kind       ErrorKind
 	Message    string
+	// The underlying error, if any
+	Err error
 }
 
 func (e *Error) Error() string {
 	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
 }
 
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 // NewBadRequestError creates a new CustomError with a 400 status code.
 func NewBadRequestError(message string) error {
 	return &Error{
 		StatusCode: http.StatusBadRequest,
+		Kind:       ErrorKindBadInput,
 		Message:    message,
 	}
 }
@@ -26,6 +67,112 @@ func NewBadRequestError(message string) error {
 func NewBadRequestErrorf(format string, args ...interface{}) error {
 	return &Error{
 		StatusCode: http.StatusBadRequest,
+		Kind:       ErrorKindBadInput,
 		Message:    fmt.Sprintf(format, args...),
 	}
 }
+
+// NewBadInputError wraps an error caused by a record that can't be processed.
+func NewBadInputError(err error) error {
+	return &Error{
+		StatusCode: http.StatusBadRequest,
+		Kind:       ErrorKindBadInput,
+		Message:    err.Error(),
+		Err:        err,
+	}
+}
+
+// NewRetryableError wraps an error from a transient failure, such as a timeout
+// calling an external service.
+func NewRetryableError(err error) error {
+	return &Error{
+		StatusCode: http.StatusServiceUnavailable,
+		Kind:       ErrorKindRetryable,
+		Message:    err.Error(),
+		Err:        err,
+	}
+}
+
+// NewUserError wraps an error returned by a handler unless the handler already
+// classified it.
+func NewUserError(err error) error {
+	var rxnErr *Error
+	if errors.As(err, &rxnErr) {
+		return err
+	}
+	return &Error{
+		StatusCode: http.StatusInternalServerError,
+		Kind:       ErrorKindUser,
+		Message:    err.Error(),
+		Err:        err,
+	}
+}
+
+// ErrorMessage returns err's message without the status code that an [Error]
+// adds.
+func ErrorMessage(err error) string {
+	if rxnErr, ok := err.(*Error); ok {
+		return rxnErr.Message
+	}
+	return err.Error()
+}
+
+// ErrorKindOf returns the kind of the first classified error in err's chain.
+// Unclassified errors are internal errors.
+func ErrorKindOf(err error) ErrorKind {
+	var rxnErr *Error
+	var stateErr *StateError
+	var panicErr *PanicError
+	switch {
+	case errors.As(err, &rxnErr):
+		return rxnErr.Kind
+	case errors.As(err, &stateErr):
+		return ErrorKindStateCorruption
+	case errors.As(err, &panicErr):
+		return ErrorKindUser
+	default:
+		return ErrorKindInternal
+	}
+}
+
+// PanicError is a panic recovered while handling a request.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// StateError reports that a key's state could not be loaded or saved, for
+// instance because a stored entry failed to decode.
+type StateError struct {
+	Key     []byte
+	StateID string
+	Err     error
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("state %q for key %x: %v", e.StateID, e.Key, e.Err)
+}
+
+func (e *StateError) Unwrap() error {
+	return e.Err
+}
+
+// SinkError reports that a value collected for a key could not be sent to a
+// sink.
+type SinkError struct {
+	Key    []byte
+	SinkID string
+	Err    error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("sink %q for key %x: %v", e.SinkID, e.Key, e.Err)
+}
+
+func (e *SinkError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,9 @@
+package internal
+
+import "context"
+
+// Lifecycle hooks are called when the handler starts and stops.
+type Lifecycle interface {
+	Open(ctx context.Context) error
+	Close(ctx context.Context) error
+}
@@ -0,0 +1,423 @@
+// Package localrun processes events with a synthesized handler in the current
+// process, standing in for the Reduction engine in tests.
+package localrun
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/rxn"
+	"reduction.dev/reduction-protocol/handlerpb"
+)
+
+// Runner sends events to a handler in batches, keeps each key's state and
+// timers between batches, and fires timers as the watermark advances.
+type Runner struct {
+	handler      *internal.SynthesizedHandler
+	state        map[string]map[string]map[string][]byte // <key>:<namespace>:<entry-key>:<value>
+	timers       map[string][]time.Time                  // <key>:<timers>
+	pending      []*handlerpb.Event
+	watermark    time.Time
+	maxEventTime time.Time
+	sinkRequests []*handlerpb.SinkRequest
+	// The processing time reported to the handler
+	processingTime time.Time
+	// Number of sink requests included in previous snapshots
+	snapshotSinkRequests int
+	// A textual record of each batch and its results
+	transcript strings.Builder
+	batches    int
+	// When set, orders expired timers across keys randomly
+	timerRand *rand.Rand
+}
+
+// Snapshot is the state and output of a run between batches.
+type Snapshot struct {
+	Watermark      time.Time
+	ProcessingTime time.Time
+	// Values collected for each sink since the previous snapshot
+	SinkValues map[string][][]byte
+	// Stored state entry values by key, state ID, and entry key
+	State map[string]map[string]map[string][]byte
+}
+
+// New creates a runner for the handler. The runner takes over the handler's
+// clock so that processing time starts at the Unix epoch and only moves with
+// AdvanceProcessingTime.
+func New(handler *internal.SynthesizedHandler) *Runner {
+	r := &Runner{
+		handler:        handler,
+		state:          make(map[string]map[string]map[string][]byte),
+		timers:         make(map[string][]time.Time),
+		processingTime: time.Unix(0, 0).UTC(),
+	}
+	handler.Now = func() time.Time { return r.processingTime }
+	return r
+}
+
+// AddEvent queues a keyed event for the next batch.
+func (r *Runner) AddEvent(event internal.KeyedEvent) {
+	r.pending = append(r.pending, &handlerpb.Event{
+		Event: &handlerpb.Event_KeyedEvent{
+			KeyedEvent: &handlerpb.KeyedEvent{
+				Key:       event.Key,
+				Timestamp: timestamppb.New(event.Timestamp),
+				Value:     event.Value,
+			},
+		},
+	})
+	if event.Timestamp.After(r.maxEventTime) {
+		r.maxEventTime = event.Timestamp
+	}
+}
+
+// AdvanceWatermark processes queued events and then advances the watermark to
+// the latest event time, firing the timers that it passes.
+func (r *Runner) AdvanceWatermark(ctx context.Context) error {
+	return r.AdvanceWatermarkTo(ctx, r.maxEventTime)
+}
+
+// AdvanceWatermarkTo processes queued events and then advances the watermark
+// to the given time, firing the timers that it passes. The watermark never
+// moves backwards.
+func (r *Runner) AdvanceWatermarkTo(ctx context.Context, watermark time.Time) error {
+	if err := r.Flush(ctx); err != nil {
+		return err
+	}
+	if watermark.After(r.watermark) {
+		r.watermark = watermark
+	}
+	return r.fireTimers(ctx)
+}
+
+// AdvanceProcessingTime processes queued events and then moves the processing
+// time forward by d for later batches.
+func (r *Runner) AdvanceProcessingTime(ctx context.Context, d time.Duration) error {
+	if err := r.Flush(ctx); err != nil {
+		return err
+	}
+	r.processingTime = r.processingTime.Add(d)
+	return nil
+}
+
+// Subject returns a subject over a key's stored state for reading state
+// through state specs. Changes made with the subject are discarded.
+func (r *Runner) Subject(key []byte) *internal.Subject {
+	return internal.NewSubject(key, stateEntries(r.state[string(key)]), r.watermark, r.watermark, r.processingTime)
+}
+
+// SeedState processes queued events and then calls seed with a subject for
+// the key. The state changes and timers that seed makes are stored as if a
+// handler made them.
+func (r *Runner) SeedState(ctx context.Context, key []byte, seed func(subject *internal.Subject)) error {
+	if err := r.Flush(ctx); err != nil {
+		return err
+	}
+	subject := r.Subject(key)
+	seed(subject)
+	result, err := subject.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to seed state for key %x: %w", key, err)
+	}
+	fmt.Fprintf(&r.transcript, "seed %q\n", key)
+	writeKeyResult(&r.transcript, result)
+	r.transcript.WriteString("\n")
+	r.applyKeyResult(result)
+	return nil
+}
+
+// Snapshot processes queued events and returns the run's current state and
+// the sink values collected since the previous snapshot.
+func (r *Runner) Snapshot(ctx context.Context) (Snapshot, error) {
+	if err := r.Flush(ctx); err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshot := Snapshot{
+		Watermark:      r.watermark,
+		ProcessingTime: r.processingTime,
+		SinkValues:     make(map[string][][]byte),
+		State:          make(map[string]map[string]map[string][]byte, len(r.state)),
+	}
+	for _, req := range r.sinkRequests[r.snapshotSinkRequests:] {
+		snapshot.SinkValues[req.Id] = append(snapshot.SinkValues[req.Id], req.Value)
+	}
+	r.snapshotSinkRequests = len(r.sinkRequests)
+	for key, namespaces := range r.state {
+		snapshot.State[key] = make(map[string]map[string][]byte, len(namespaces))
+		for namespace, entries := range namespaces {
+			snapshot.State[key][namespace] = maps.Clone(entries)
+		}
+	}
+	return snapshot, nil
+}
+
+// Flush processes queued events in a single batch.
+func (r *Runner) Flush(ctx context.Context) error {
+	events := r.pending
+	r.pending = nil
+	return r.processBatch(ctx, events)
+}
+
+// ShuffleTimers makes the runner send the expired timers of different keys in
+// a random order drawn from rng. Each key's timers still expire in time order.
+func (r *Runner) ShuffleTimers(rng *rand.Rand) {
+	r.timerRand = rng
+}
+
+// SinkValues returns the values collected for a sink by the handler.
+func (r *Runner) SinkValues(sinkID string) [][]byte {
+	var values [][]byte
+	for _, req := range r.sinkRequests {
+		if req.Id == sinkID {
+			values = append(values, req.Value)
+		}
+	}
+	return values
+}
+
+// fireTimers sends batches of expired timers until no timers are before the
+// watermark. Timers set while handling expired timers may expire as well.
+func (r *Runner) fireTimers(ctx context.Context) error {
+	for {
+		var events []*handlerpb.Event
+		for _, key := range slices.Sorted(maps.Keys(r.timers)) {
+			var remaining []time.Time
+			for _, timer := range r.timers[key] {
+				if timer.After(r.watermark) {
+					remaining = append(remaining, timer)
+					continue
+				}
+				events = append(events, &handlerpb.Event{
+					Event: &handlerpb.Event_TimerExpired{
+						TimerExpired: &handlerpb.TimerExpired{
+							Key:       []byte(key),
+							Timestamp: timestamppb.New(timer),
+						},
+					},
+				})
+			}
+			if len(remaining) == 0 {
+				delete(r.timers, key)
+			} else {
+				r.timers[key] = remaining
+			}
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		slices.SortStableFunc(events, func(a, b *handlerpb.Event) int {
+			return a.GetTimerExpired().Timestamp.AsTime().Compare(b.GetTimerExpired().Timestamp.AsTime())
+		})
+		if r.timerRand != nil {
+			events = InterleaveKeys(r.timerRand, events, func(event *handlerpb.Event) []byte {
+				return event.GetTimerExpired().Key
+			})
+		}
+		if err := r.processBatch(ctx, events); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Runner) processBatch(ctx context.Context, events []*handlerpb.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	req := &handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(r.watermark),
+		Events:    events,
+		KeyStates: r.keyStates(events),
+	}
+	resp, err := r.handler.ProcessEventBatch(ctx, req)
+	if err != nil {
+		return err
+	}
+	r.writeBatch(req, resp)
+
+	for _, result := range resp.KeyResults {
+		r.applyKeyResult(result)
+	}
+	r.sinkRequests = append(r.sinkRequests, resp.SinkRequests...)
+	return nil
+}
+
+// Transcript returns a stable textual record of the batches sent to the
+// handler and their results: events, expired timers, state mutations, new
+// timers, and sink requests.
+func (r *Runner) Transcript() string {
+	return r.transcript.String()
+}
+
+func (r *Runner) writeBatch(req *handlerpb.ProcessEventBatchRequest, resp *handlerpb.ProcessEventBatchResponse) {
+	r.batches++
+	w := &r.transcript
+	fmt.Fprintf(w, "batch %d (watermark %s, processing time %s)\n", r.batches, formatTime(r.watermark), formatTime(r.processingTime))
+	for _, event := range req.Events {
+		switch typed := event.Event.(type) {
+		case *handlerpb.Event_KeyedEvent:
+			fmt.Fprintf(w, "  event %q at %s: %q\n", typed.KeyedEvent.Key, formatTime(typed.KeyedEvent.Timestamp.AsTime()), typed.KeyedEvent.Value)
+		case *handlerpb.Event_TimerExpired:
+			fmt.Fprintf(w, "  timer expired %q at %s\n", typed.TimerExpired.Key, formatTime(typed.TimerExpired.Timestamp.AsTime()))
+		}
+	}
+	for _, result := range resp.KeyResults {
+		fmt.Fprintf(w, "  result %q\n", result.Key)
+		writeKeyResult(w, result)
+	}
+	for _, sinkReq := range resp.SinkRequests {
+		fmt.Fprintf(w, "  sink %q: %q\n", sinkReq.Id, sinkReq.Value)
+	}
+	w.WriteString("\n")
+}
+
+func writeKeyResult(w *strings.Builder, result *handlerpb.KeyResult) {
+	for _, timer := range result.NewTimers {
+		fmt.Fprintf(w, "    set timer %s\n", formatTime(timer.AsTime()))
+	}
+	for _, namespace := range result.StateMutationNamespaces {
+		for _, mutation := range namespace.Mutations {
+			switch typed := mutation.Mutation.(type) {
+			case *handlerpb.StateMutation_Put:
+				fmt.Fprintf(w, "    put %s %q = %q\n", namespace.Namespace, typed.Put.Key, typed.Put.Value)
+			case *handlerpb.StateMutation_Delete:
+				fmt.Fprintf(w, "    delete %s %q\n", namespace.Namespace, typed.Delete.Key)
+			}
+		}
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// keyStates returns the stored state for each key in the events.
+func (r *Runner) keyStates(events []*handlerpb.Event) []*handlerpb.KeyState {
+	var keyStates []*handlerpb.KeyState
+	seen := make(map[string]bool)
+	for _, event := range events {
+		key := event.GetKeyedEvent().GetKey()
+		if timer := event.GetTimerExpired(); timer != nil {
+			key = timer.Key
+		}
+		if seen[string(key)] {
+			continue
+		}
+		seen[string(key)] = true
+
+		namespaces := r.state[string(key)]
+		keyState := &handlerpb.KeyState{Key: key}
+		for _, namespace := range slices.Sorted(maps.Keys(namespaces)) {
+			entries := namespaces[namespace]
+			pbNamespace := &handlerpb.StateEntryNamespace{Namespace: namespace}
+			for _, entryKey := range slices.Sorted(maps.Keys(entries)) {
+				pbNamespace.Entries = append(pbNamespace.Entries, &handlerpb.StateEntry{
+					Key:   []byte(entryKey),
+					Value: entries[entryKey],
+				})
+			}
+			keyState.StateEntryNamespaces = append(keyState.StateEntryNamespaces, pbNamespace)
+		}
+		keyStates = append(keyStates, keyState)
+	}
+	return keyStates
+}
+
+// applyKeyResult stores a key's state mutations and new timers.
+func (r *Runner) applyKeyResult(result *handlerpb.KeyResult) {
+	key := string(result.Key)
+	for _, namespace := range result.StateMutationNamespaces {
+		for _, mutation := range namespace.Mutations {
+			switch typed := mutation.Mutation.(type) {
+			case *handlerpb.StateMutation_Put:
+				r.namespace(key, namespace.Namespace)[string(typed.Put.Key)] = bytes.Clone(typed.Put.Value)
+			case *handlerpb.StateMutation_Delete:
+				delete(r.namespace(key, namespace.Namespace), string(typed.Delete.Key))
+			}
+		}
+		if len(r.state[key][namespace.Namespace]) == 0 {
+			delete(r.state[key], namespace.Namespace)
+		}
+	}
+	if len(r.state[key]) == 0 {
+		delete(r.state, key)
+	}
+
+	for _, pbTimer := range result.NewTimers {
+		timer := pbTimer.AsTime()
+		if !slices.ContainsFunc(r.timers[key], timer.Equal) {
+			r.timers[key] = append(r.timers[key], timer)
+		}
+	}
+}
+
+// Subject returns a subject over a key's state at the time of the snapshot
+// for reading state through state specs. Changes made with the subject are
+// discarded.
+func (s Snapshot) Subject(key []byte) rxn.Subject {
+	return internal.NewSubject(key, stateEntries(s.State[string(key)]), s.Watermark, s.Watermark, s.ProcessingTime)
+}
+
+// stateEntries converts a key's stored state to entries sorted by key.
+func stateEntries(namespaces map[string]map[string][]byte) map[string][]internal.StateEntry {
+	state := make(map[string][]internal.StateEntry, len(namespaces))
+	for namespace, entries := range namespaces {
+		for _, entryKey := range slices.Sorted(maps.Keys(entries)) {
+			state[namespace] = append(state[namespace], internal.StateEntry{
+				Key:   []byte(entryKey),
+				Value: entries[entryKey],
+			})
+		}
+	}
+	return state
+}
+
+func (r *Runner) namespace(key, namespace string) map[string][]byte {
+	if r.state[key] == nil {
+		r.state[key] = make(map[string]map[string][]byte)
+	}
+	if r.state[key][namespace] == nil {
+		r.state[key][namespace] = make(map[string][]byte)
+	}
+	return r.state[key][namespace]
+}
+
+// InterleaveKeys returns the items in a random order drawn from rng that keeps
+// the relative order of items with the same key.
+func InterleaveKeys[T any](rng *rand.Rand, items []T, key func(T) []byte) []T {
+	var keys []string
+	byKey := make(map[string][]T)
+	for _, item := range items {
+		k := string(key(item))
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], item)
+	}
+
+	// Picking the key of a uniformly chosen remaining item gives every
+	// order-preserving interleaving the same chance.
+	interleaved := make([]T, 0, len(items))
+	for remaining := len(items); remaining > 0; remaining-- {
+		n := rng.IntN(remaining)
+		for _, k := range keys {
+			if n < len(byKey[k]) {
+				interleaved = append(interleaved, byKey[k][0])
+				byKey[k] = byKey[k][1:]
+				break
+			}
+			n -= len(byKey[k])
+		}
+	}
+	return interleaved
+}
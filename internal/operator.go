@@ -7,26 +7,39 @@ type OperatorParams struct {
 type Operator struct {
 	ID          string
 	Parallelism int
+	KeyWorkers  int
 	Handler     OperatorHandler
-	Sinks       []SinkSynthesizer
-	stateSpecs  map[string]QueryType
+	// Optional hooks implemented by the handler
+	BatchHooks BatchHooks
+	Lifecycle  Lifecycle
+	Sinks      []SinkSynthesizer
+	stateSpecs map[string]QueryType
+	expirers   []StateExpirer
 }
 
+// StateExpirer deletes a subject's expired state entries. Expirers run when a
+// system timer fires for the subject.
+type StateExpirer = func(subject *Subject)
+
 type QueryType = string
 
 const QueryTypeGet QueryType = "get"
 const QueryTypeScan QueryType = "scan"
 
 func NewOperator(id string) *Operator {
-	// ID is currently unused.
 	return &Operator{
+		ID:         id,
 		stateSpecs: make(map[string]QueryType),
 	}
 }
 
 func (o *Operator) Synthesize() OperatorSynthesis {
 	return OperatorSynthesis{
-		Handler: o.Handler,
+		Handler:       o.Handler,
+		StateExpirers: o.expirers,
+		KeyWorkers:    o.KeyWorkers,
+		BatchHooks:    o.BatchHooks,
+		Lifecycle:     o.Lifecycle,
 	}
 }
 
@@ -38,6 +51,14 @@ func (op *Operator) RegisterSpec(id string, queryType QueryType) {
 	op.stateSpecs[id] = queryType
 }
 
+func (op *Operator) RegisterExpirer(expirer StateExpirer) {
+	op.expirers = append(op.expirers, expirer)
+}
+
 type OperatorSynthesis struct {
-	Handler OperatorHandler
+	Handler       OperatorHandler
+	StateExpirers []StateExpirer
+	KeyWorkers    int
+	BatchHooks    BatchHooks
+	Lifecycle     Lifecycle
 }
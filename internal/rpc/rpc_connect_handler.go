@@ -18,7 +18,8 @@ func NewConnectHandler(handler *internal.SynthesizedHandler) *ConnectHandler {
 	return &ConnectHandler{handler}
 }
 
-func (r *ConnectHandler) KeyEventBatch(ctx context.Context, req *connect.Request[handlerpb.KeyEventBatchRequest]) (*connect.Response[handlerpb.KeyEventBatchResponse], error) {
+func (r *ConnectHandler) KeyEventBatch(ctx context.Context, req *connect.Request[handlerpb.KeyEventBatchRequest]) (_ *connect.Response[handlerpb.KeyEventBatchResponse], err error) {
+	defer recoverPanic(&err, handleError)
 	resp, err := r.rxnHandler.KeyEventBatch(ctx, req.Msg)
 	if err != nil {
 		return nil, handleError(err)
@@ -26,7 +27,8 @@ func (r *ConnectHandler) KeyEventBatch(ctx context.Context, req *connect.Request
 	return connect.NewResponse(resp), nil
 }
 
-func (r *ConnectHandler) ProcessEventBatch(ctx context.Context, req *connect.Request[handlerpb.ProcessEventBatchRequest]) (*connect.Response[handlerpb.ProcessEventBatchResponse], error) {
+func (r *ConnectHandler) ProcessEventBatch(ctx context.Context, req *connect.Request[handlerpb.ProcessEventBatchRequest]) (_ *connect.Response[handlerpb.ProcessEventBatchResponse], err error) {
+	defer recoverPanic(&err, handleError)
 	resp, err := r.rxnHandler.ProcessEventBatch(ctx, req.Msg)
 	if err != nil {
 		return nil, handleError(err)
@@ -35,11 +37,4 @@ func (r *ConnectHandler) ProcessEventBatch(ctx context.Context, req *connect.Req
 	return connect.NewResponse(resp), nil
 }
 
-func handleError(err error) error {
-	if rxnErr, ok := err.(*internal.Error); ok {
-		return connect.NewError(connect.CodeInvalidArgument, rxnErr)
-	}
-	return err
-}
-
 var _ handlerpbconnect.HandlerHandler = (*ConnectHandler)(nil)
@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"runtime/debug"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/types/known/structpb"
+	"reduction.dev/reduction-go/internal"
+)
+
+// Metadata keys identifying the key, state, and sink of a failed request.
+const (
+	errorKindHeader    = "Rxn-Error-Kind"
+	errorKeyHeader     = "Rxn-Error-Key"
+	errorStateIDHeader = "Rxn-Error-State-Id"
+	errorSinkIDHeader  = "Rxn-Error-Sink-Id"
+)
+
+// Connect codes for each kind of error.
+var errorKindCodes = map[internal.ErrorKind]connect.Code{
+	internal.ErrorKindInternal:        connect.CodeInternal,
+	internal.ErrorKindBadInput:        connect.CodeInvalidArgument,
+	internal.ErrorKindRetryable:       connect.CodeUnavailable,
+	internal.ErrorKindStateCorruption: connect.CodeDataLoss,
+	internal.ErrorKindUser:            connect.CodeAborted,
+}
+
+// recoverPanic recovers a panic from handling a request, logs it with its
+// stack trace, and replaces the request's error. Call it deferred.
+func recoverPanic(err *error, handle func(error) error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	stack := debug.Stack()
+	slog.Error("recovered panic while handling request", "panic", value, "stack", string(stack))
+	*err = handle(&internal.PanicError{Value: value, Stack: stack})
+}
+
+// handleError converts an error to a connect error with a code for its kind.
+// The error's kind and the key, state, or sink that failed are included as
+// response metadata and as an error detail.
+func handleError(err error) error {
+	kind := internal.ErrorKindOf(err)
+	connectErr := connect.NewError(errorKindCodes[kind], err)
+	connectErr.Meta().Set(errorKindHeader, kind.String())
+	info := map[string]any{"kind": kind.String()}
+
+	var stateErr *internal.StateError
+	var sinkErr *internal.SinkError
+	switch {
+	case errors.As(err, &stateErr):
+		key := hex.EncodeToString(stateErr.Key)
+		connectErr.Meta().Set(errorKeyHeader, key)
+		connectErr.Meta().Set(errorStateIDHeader, stateErr.StateID)
+		info["key"], info["stateId"] = key, stateErr.StateID
+	case errors.As(err, &sinkErr):
+		key := hex.EncodeToString(sinkErr.Key)
+		connectErr.Meta().Set(errorKeyHeader, key)
+		connectErr.Meta().Set(errorSinkIDHeader, sinkErr.SinkID)
+		info["key"], info["sinkId"] = key, sinkErr.SinkID
+	}
+
+	if details, err := structpb.NewStruct(info); err == nil {
+		if detail, err := connect.NewErrorDetail(details); err == nil {
+			connectErr.AddDetail(detail)
+		}
+	}
+	return connectErr
+}
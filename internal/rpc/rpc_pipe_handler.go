@@ -96,7 +96,8 @@ func (r *PipeHandler) ProcessMessages(ctx context.Context) error {
 	}
 }
 
-func (r *PipeHandler) handleKeyEventBatch(ctx context.Context, req *handlerpb.KeyEventBatchRequest) error {
+func (r *PipeHandler) handleKeyEventBatch(ctx context.Context, req *handlerpb.KeyEventBatchRequest) (err error) {
+	defer recoverPanic(&err, func(err error) error { return err })
 	resp, err := r.rxnHandler.KeyEventBatch(ctx, req)
 	if err != nil {
 		return err
@@ -104,7 +105,8 @@ func (r *PipeHandler) handleKeyEventBatch(ctx context.Context, req *handlerpb.Ke
 	return r.writeResponse(resp)
 }
 
-func (r *PipeHandler) handleProcessEventBatch(ctx context.Context, req *handlerpb.ProcessEventBatchRequest) error {
+func (r *PipeHandler) handleProcessEventBatch(ctx context.Context, req *handlerpb.ProcessEventBatchRequest) (err error) {
+	defer recoverPanic(&err, func(err error) error { return err })
 	resp, err := r.rxnHandler.ProcessEventBatch(ctx, req)
 	if err != nil {
 		return err
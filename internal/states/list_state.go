@@ -0,0 +1,147 @@
+package states
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"slices"
+
+	"reduction.dev/reduction-go/internal"
+)
+
+// ListState is an append-only list stored as one state entry per item. Entry
+// keys are big-endian item indexes so that stored items sort in append order
+// and new items only produce mutations for the appended tail.
+type ListState[T any] struct {
+	name      string
+	items     []listItem[T]
+	deleted   [][]byte // keys of loaded items that were removed
+	appended  int      // number of trailing items in items not yet persisted
+	nextIndex uint64
+	codec     ValueCodec[T]
+	writeClock
+}
+
+type listItem[T any] struct {
+	key   []byte
+	value T
+}
+
+func NewListState[T any](name string, codec ValueCodec[T]) *ListState[T] {
+	return &ListState[T]{
+		name:  name,
+		codec: codec,
+	}
+}
+
+// Append adds a value to the end of the list.
+func (s *ListState[T]) Append(value T) {
+	key := binary.BigEndian.AppendUint64(nil, s.nextIndex)
+	s.items = append(s.items, listItem[T]{key: key, value: value})
+	s.recordWrite(key)
+	s.nextIndex++
+	s.appended++
+}
+
+// All iterates over the values in the order they were appended.
+func (s *ListState[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, item := range s.items {
+			if !yield(item.value) {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of values in the list.
+func (s *ListState[T]) Len() int {
+	return len(s.items)
+}
+
+// Clear removes all values from the list.
+func (s *ListState[T]) Clear() {
+	s.KeepLast(0)
+}
+
+// KeepLast removes values from the front of the list until at most n remain.
+func (s *ListState[T]) KeepLast(n int) {
+	drop := len(s.items) - max(n, 0)
+	if drop <= 0 {
+		return
+	}
+
+	persisted := len(s.items) - s.appended
+	for _, item := range s.items[:min(drop, persisted)] {
+		s.deleted = append(s.deleted, item.key)
+	}
+	if drop > persisted {
+		s.appended -= drop - persisted
+	}
+	// Reslice rather than shift the items so that snapshots keep theirs
+	s.items = s.items[drop:]
+}
+
+// Snapshot records the list so that the returned function can restore it.
+// Items are only appended past the end of the list or dropped from its front,
+// so the snapshot shares their backing arrays.
+func (s *ListState[T]) Snapshot() (restore func()) {
+	items, deleted, appended, nextIndex := s.items, s.deleted, s.appended, s.nextIndex
+	restoreClock := s.writeClock.snapshot()
+	return func() {
+		s.items, s.deleted, s.appended, s.nextIndex = items, deleted, appended, nextIndex
+		restoreClock()
+	}
+}
+
+func (s *ListState[T]) Load(entries []internal.StateEntry) error {
+	entries = slices.Clone(entries)
+	slices.SortFunc(entries, func(a, b internal.StateEntry) int {
+		return bytes.Compare(a.Key, b.Key)
+	})
+
+	items := make([]listItem[T], len(entries))
+	for i, entry := range entries {
+		if len(entry.Key) != 8 {
+			return fmt.Errorf("invalid list item key length %d", len(entry.Key))
+		}
+		value, err := s.codec.Decode(entry.Value)
+		if err != nil {
+			return fmt.Errorf("failed to decode list item: %w", err)
+		}
+		items[i] = listItem[T]{key: entry.Key, value: value}
+	}
+
+	s.items = items
+	s.deleted = nil
+	s.appended = 0
+	s.nextIndex = 0
+	if len(items) > 0 {
+		s.nextIndex = binary.BigEndian.Uint64(items[len(items)-1].key) + 1
+	}
+	return nil
+}
+
+func (s *ListState[T]) Mutations() ([]internal.StateMutation, error) {
+	mutations := make([]internal.StateMutation, 0, len(s.deleted)+s.appended)
+	for _, key := range s.deleted {
+		mutations = append(mutations, &internal.DeleteMutation{Key: key})
+	}
+	for _, item := range s.items[len(s.items)-s.appended:] {
+		data, err := s.codec.Encode(item.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode list item: %w", err)
+		}
+		mutations = append(mutations, &internal.PutMutation{Key: item.key, Value: data})
+	}
+	return mutations, nil
+}
+
+// Name returns the state's name
+func (s *ListState[T]) Name() string {
+	return s.name
+}
+
+var _ internal.StateItem = (*ListState[int])(nil)
+var _ internal.Snapshotter = (*ListState[int])(nil)
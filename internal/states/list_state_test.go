@@ -0,0 +1,113 @@
+package states_test
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/internal/states"
+)
+
+func TestListState_AppendOnlyEmitsTail(t *testing.T) {
+	state := states.NewListState("id", listCodec)
+	err := state.Load([]internal.StateEntry{
+		{Key: listKey(1), Value: []byte("b")},
+		{Key: listKey(0), Value: []byte("a")},
+	})
+	require.NoError(t, err, "loading initial state should not error")
+
+	state.Append("c")
+
+	assert.Equal(t, []string{"a", "b", "c"}, slices.Collect(state.All()))
+	assert.Equal(t, 3, state.Len())
+
+	mutations, err := state.Mutations()
+	require.NoError(t, err, "getting mutations should not error")
+	assert.Equal(t, []internal.StateMutation{
+		&internal.PutMutation{Key: listKey(2), Value: []byte("c")},
+	}, mutations)
+}
+
+func TestListState_KeepLast(t *testing.T) {
+	state := states.NewListState("id", listCodec)
+	err := state.Load([]internal.StateEntry{
+		{Key: listKey(0), Value: []byte("a")},
+		{Key: listKey(1), Value: []byte("b")},
+	})
+	require.NoError(t, err, "loading initial state should not error")
+
+	state.Append("c")
+	state.Append("d")
+	state.KeepLast(1)
+
+	assert.Equal(t, []string{"d"}, slices.Collect(state.All()))
+
+	mutations, err := state.Mutations()
+	require.NoError(t, err, "getting mutations should not error")
+	assert.Equal(t, []internal.StateMutation{
+		&internal.DeleteMutation{Key: listKey(0)},
+		&internal.DeleteMutation{Key: listKey(1)},
+		&internal.PutMutation{Key: listKey(3), Value: []byte("d")},
+	}, mutations)
+}
+
+func TestListState_ClearThenAppend(t *testing.T) {
+	state := states.NewListState("id", listCodec)
+	err := state.Load([]internal.StateEntry{
+		{Key: listKey(0), Value: []byte("a")},
+	})
+	require.NoError(t, err, "loading initial state should not error")
+
+	state.Clear()
+	assert.Equal(t, 0, state.Len(), "list should be empty after clear")
+	state.Append("b")
+
+	mutations, err := state.Mutations()
+	require.NoError(t, err, "getting mutations should not error")
+	assert.Equal(t, []internal.StateMutation{
+		&internal.DeleteMutation{Key: listKey(0)},
+		&internal.PutMutation{Key: listKey(1), Value: []byte("b")},
+	}, mutations)
+}
+
+func listKey(i uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, i)
+}
+
+// A ValueCodec for strings
+type StringCodec struct{}
+
+func (StringCodec) Encode(value string) ([]byte, error) {
+	return []byte(value), nil
+}
+
+func (StringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+var listCodec states.ValueCodec[string] = StringCodec{}
+
+func TestListState_SnapshotRestoresList(t *testing.T) {
+	state := states.NewListState("id", listCodec)
+	err := state.Load([]internal.StateEntry{
+		{Key: listKey(0), Value: []byte("a")},
+		{Key: listKey(1), Value: []byte("b")},
+	})
+	require.NoError(t, err, "loading initial state should not error")
+	state.Append("c")
+
+	restore := state.Snapshot()
+	state.KeepLast(1)
+	state.Append("d")
+	restore()
+
+	assert.Equal(t, []string{"a", "b", "c"}, slices.Collect(state.All()))
+	mutations, err := state.Mutations()
+	require.NoError(t, err, "getting mutations should not error")
+	assert.Equal(t, []internal.StateMutation{
+		&internal.PutMutation{Key: listKey(2), Value: []byte("c")},
+	}, mutations)
+}
@@ -2,6 +2,7 @@ package states
 
 import (
 	"iter"
+	"maps"
 
 	"reduction.dev/reduction-go/internal"
 )
@@ -12,6 +13,7 @@ type MapState[K comparable, V any] struct {
 	updates  map[K]ValueUpdate[V]
 	codec    MapCodec[K, V]
 	size     int // tracks current number of items
+	writeClock
 }
 
 type ValueUpdate[V any] struct {
@@ -26,6 +28,13 @@ type MapCodec[K comparable, V any] interface {
 	DecodeValue(b []byte) (V, error)
 }
 
+// UpgradableMapCodec is implemented by map codecs that can decode values
+// written in an older format. Values that need an upgrade are rewritten in the
+// codec's current format with the state's next mutations.
+type UpgradableMapCodec interface {
+	ValueNeedsUpgrade([]byte) bool
+}
+
 // NewMapState creates a new MapState, applying any provided options.
 func NewMapState[K comparable, V any](name string, codec MapCodec[K, V]) *MapState[K, V] {
 	return &MapState[K, V]{
@@ -43,6 +52,12 @@ func (s *MapState[K, V]) Set(key K, value V) {
 	s.updates[key] = ValueUpdate[V]{
 		Value: value,
 	}
+	if s.now != nil {
+		// Encoding errors are returned by Mutations
+		if keyBytes, err := s.codec.EncodeKey(key); err == nil {
+			s.recordWrite(keyBytes)
+		}
+	}
 
 	if !hadKey {
 		s.size++
@@ -125,6 +140,7 @@ func (s *MapState[K, V]) Mutations() ([]internal.StateMutation, error) {
 }
 
 func (s *MapState[K, V]) Load(entries []internal.StateEntry) error {
+	upgradable, _ := s.codec.(UpgradableMapCodec)
 	result := make(map[K]V, len(entries))
 	for _, e := range entries {
 		key, err := s.codec.DecodeKey(e.Key)
@@ -136,12 +152,25 @@ func (s *MapState[K, V]) Load(entries []internal.StateEntry) error {
 			return err
 		}
 		result[key] = value
+		if upgradable != nil && upgradable.ValueNeedsUpgrade(e.Value) {
+			s.updates[key] = ValueUpdate[V]{Value: value}
+		}
 	}
 	s.original = result
 	s.size = len(result)
 	return nil
 }
 
+// Snapshot records the pending updates so that the returned function can
+// restore them.
+func (s *MapState[K, V]) Snapshot() (restore func()) {
+	updates, size, restoreClock := maps.Clone(s.updates), s.size, s.writeClock.snapshot()
+	return func() {
+		s.updates, s.size = updates, size
+		restoreClock()
+	}
+}
+
 // Name returns the state's name
 func (s *MapState[K, V]) Name() string {
 	return s.name
@@ -153,3 +182,4 @@ func (s *MapState[K, V]) Size() int {
 }
 
 var _ internal.StateItem = (*MapState[any, any])(nil)
+var _ internal.Snapshotter = (*MapState[any, any])(nil)
@@ -1,6 +1,7 @@
 package states_test
 
 import (
+	"maps"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -130,3 +131,24 @@ func (m MapCodec) DecodeValue(data []byte) (string, error) {
 }
 
 var codec states.MapCodec[string, string] = MapCodec{}
+
+func TestMapState_SnapshotRestoresUpdates(t *testing.T) {
+	state := states.NewMapState("id", codec)
+	err := state.Load([]internal.StateEntry{{Key: []byte("k1"), Value: []byte("v1")}})
+	assert.NoError(t, err, "loading initial state should not error")
+	state.Set("k2", "v2")
+
+	restore := state.Snapshot()
+	state.Delete("k1")
+	state.Set("k2", "changed")
+	state.Set("k3", "v3")
+	restore()
+
+	assert.Equal(t, map[string]string{"k1": "v1", "k2": "v2"}, maps.Collect(state.All()))
+	assert.Equal(t, 2, state.Size())
+	mutations, err := state.Mutations()
+	assert.NoError(t, err, "getting mutations should not error")
+	assert.Equal(t, []internal.StateMutation{
+		&internal.PutMutation{Key: []byte("k2"), Value: []byte("v2")},
+	}, mutations)
+}
@@ -1,7 +1,7 @@
 package states
 
 import (
-	"fmt"
+	"time"
 
 	"reduction.dev/reduction-go/internal"
 )
@@ -11,20 +11,74 @@ type StateSpec[T any] struct {
 	Query     internal.QueryType
 	Load      func([]internal.StateEntry) (*T, error)
 	Mutations func(*T) ([]internal.StateMutation, error)
+	// Optional expiration for the state's entries
+	TTL *TTL
 }
 
+// StateFor loads the state for the subject's key. If the stored state can't be
+// decoded, StateFor records a [internal.StateError] on the subject and returns
+// an empty state whose changes are discarded.
 func (s *StateSpec[T]) StateFor(subject *internal.Subject) *T {
 	if state := subject.LoadedState(s.ID); state != nil {
 		return state.(*T)
 	}
-	state, err := s.Load(subject.StateEntries(s.ID))
+
+	entries := subject.StateEntries(s.ID)
+	var expired []internal.StateMutation
+	if s.TTL != nil {
+		var err error
+		entries, expired, _, err = s.TTL.filter(entries, subject.CurrentTime(s.TTL.Domain))
+		if err != nil {
+			return s.failedState(subject, err)
+		}
+	}
+
+	state, err := s.Load(entries)
 	if err != nil {
-		panic(fmt.Sprintf("failed to load state for %s: %v", s.ID, err))
+		return s.failedState(subject, err)
+	}
+	var clock *writeClock
+	if tracker, ok := any(state).(writeTracker); ok && s.TTL != nil {
+		clock = tracker.clock()
+		clock.trackWrites(func() time.Time { return s.TTL.writeTime(subject) })
 	}
 	var mutations internal.LazyMutations = func() ([]internal.StateMutation, error) {
-		return s.Mutations(state)
+		mutations, err := s.Mutations(state)
+		if err != nil || s.TTL == nil {
+			return mutations, err
+		}
+		return append(expired, s.TTL.stamp(subject, mutations, clock)...), nil
 	}
 	subject.RegisterStateUse(s.ID, mutations)
 	subject.StoreLoadedState(s.ID, state)
 	return state
 }
+
+// Expire deletes the subject's expired entries when a system timer fires and
+// sets a new timer for the next live entry to expire.
+func (s *StateSpec[T]) Expire(subject *internal.Subject) {
+	if s.TTL == nil {
+		return
+	}
+	s.StateFor(subject)
+
+	_, _, nextExpiry, err := s.TTL.filter(subject.StateEntries(s.ID), subject.CurrentTime(s.TTL.Domain))
+	if err != nil {
+		return // Already recorded by StateFor
+	}
+	if !nextExpiry.IsZero() && s.TTL.Domain == internal.EventTime {
+		subject.SetSystemTimer(nextExpiry)
+	}
+}
+
+// failedState records a load error on the subject and returns an empty state
+// that isn't registered for mutations so the stored entries are left as is.
+func (s *StateSpec[T]) failedState(subject *internal.Subject, err error) *T {
+	subject.Fail(&internal.StateError{Key: subject.Key(), StateID: s.ID, Err: err})
+	state, err := s.Load(nil)
+	if err != nil {
+		state = new(T)
+	}
+	subject.StoreLoadedState(s.ID, state)
+	return state
+}
@@ -0,0 +1,136 @@
+package states
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"time"
+
+	"reduction.dev/reduction-go/internal"
+)
+
+// TTL expires state entries a fixed duration after they were last written.
+// Entries with a TTL are stored with their write time as an 8 byte prefix.
+//
+// With event time, an entry's write time is the timestamp of the event or timer
+// that wrote it and it expires once the watermark passes the write time plus
+// the duration. A timer is set to delete expired entries for keys that stop
+// receiving events.
+//
+// With processing time, entries expire by the handler's wall clock. Timers only
+// fire by watermark, so processing time entries are deleted the next time the
+// key's state is loaded.
+type TTL struct {
+	Duration time.Duration
+	Domain   internal.TimeDomain
+}
+
+// filter splits entries into live entries, with the write time prefix removed,
+// and delete mutations for expired entries. It also returns the earliest time
+// one of the live entries expires.
+func (t *TTL) filter(entries []internal.StateEntry, now time.Time) ([]internal.StateEntry, []internal.StateMutation, time.Time, error) {
+	live := make([]internal.StateEntry, 0, len(entries))
+	var expired []internal.StateMutation
+	var nextExpiry time.Time
+	for _, entry := range entries {
+		if len(entry.Value) < 8 {
+			return nil, nil, time.Time{}, fmt.Errorf("state entry is missing TTL write time")
+		}
+		expiry := time.Unix(0, int64(binary.BigEndian.Uint64(entry.Value))).UTC().Add(t.Duration)
+		if !expiry.After(now) {
+			expired = append(expired, &internal.DeleteMutation{Key: entry.Key})
+			continue
+		}
+		if nextExpiry.IsZero() || expiry.Before(nextExpiry) {
+			nextExpiry = expiry
+		}
+		live = append(live, internal.StateEntry{Key: entry.Key, Value: entry.Value[8:]})
+	}
+	return live, expired, nextExpiry, nil
+}
+
+// stamp prefixes put mutation values with their entry's write time and, for
+// event time, sets the timer that will delete the earliest of them. Entries
+// without a recorded write time, such as values rewritten by a codec upgrade,
+// use the subject's current write time.
+func (t *TTL) stamp(subject *internal.Subject, mutations []internal.StateMutation, clock *writeClock) []internal.StateMutation {
+	stamped := make([]internal.StateMutation, len(mutations))
+	var earliest time.Time
+	for i, m := range mutations {
+		put, ok := m.(*internal.PutMutation)
+		if !ok {
+			stamped[i] = m
+			continue
+		}
+		writeTime, ok := clock.writeTime(put.Key)
+		if !ok {
+			writeTime = t.writeTime(subject)
+		}
+		if earliest.IsZero() || writeTime.Before(earliest) {
+			earliest = writeTime
+		}
+		value := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(put.Value)), uint64(writeTime.UnixNano()))
+		stamped[i] = &internal.PutMutation{Key: put.Key, Value: append(value, put.Value...)}
+	}
+
+	if !earliest.IsZero() && t.Domain == internal.EventTime {
+		subject.SetSystemTimer(earliest.Add(t.Duration))
+	}
+	return stamped
+}
+
+// writeTime returns the time a write made with the subject happens: the
+// timestamp of the event or timer being handled, or the processing time.
+func (t *TTL) writeTime(subject *internal.Subject) time.Time {
+	if t.Domain == internal.ProcessingTime {
+		return subject.ProcessingTime()
+	}
+	return subject.Timestamp()
+}
+
+// writeClock records when a state's entries are written. A subject handles
+// all of a key's events in a batch before its mutations are encoded, so TTL
+// needs the time of each write rather than the time of the key's last event.
+type writeClock struct {
+	now   func() time.Time
+	times map[string]time.Time // by entry key
+}
+
+// trackWrites starts recording write times with now.
+func (c *writeClock) trackWrites(now func() time.Time) {
+	c.now = now
+}
+
+// recordWrite sets the entry's write time if write times are tracked.
+func (c *writeClock) recordWrite(key []byte) {
+	if c.now == nil {
+		return
+	}
+	if c.times == nil {
+		c.times = make(map[string]time.Time)
+	}
+	c.times[string(key)] = c.now()
+}
+
+// snapshot returns a function that restores the recorded write times.
+func (c *writeClock) snapshot() (restore func()) {
+	times := maps.Clone(c.times)
+	return func() { c.times = times }
+}
+
+func (c *writeClock) writeTime(key []byte) (time.Time, bool) {
+	if c == nil {
+		return time.Time{}, false
+	}
+	writeTime, ok := c.times[string(key)]
+	return writeTime, ok
+}
+
+// writeTracker is implemented by states that embed a writeClock.
+type writeTracker interface {
+	clock() *writeClock
+}
+
+func (c *writeClock) clock() *writeClock {
+	return c
+}
@@ -20,6 +20,7 @@ type ValueState[T any] struct {
 	value  T
 	status valueStatus
 	codec  ValueCodec[T]
+	writeClock
 }
 
 type ValueCodec[T any] interface {
@@ -27,6 +28,13 @@ type ValueCodec[T any] interface {
 	Decode([]byte) (T, error)
 }
 
+// UpgradableCodec is implemented by codecs that can decode data written in an
+// older format. States rewrite entries that need an upgrade in the codec's
+// current format with their next mutations.
+type UpgradableCodec interface {
+	NeedsUpgrade([]byte) bool
+}
+
 func (s *ValueState[T]) Load(entries []internal.StateEntry) error {
 	var entry internal.StateEntry
 	if len(entries) > 0 {
@@ -42,6 +50,9 @@ func (s *ValueState[T]) Load(entries []internal.StateEntry) error {
 		return fmt.Errorf("failed to decode value: %w", err)
 	}
 	s.value = value
+	if upgradable, ok := s.codec.(UpgradableCodec); ok && upgradable.NeedsUpgrade(entry.Value) {
+		s.status = statusUpdated
+	}
 	return nil
 }
 
@@ -67,6 +78,15 @@ func (s *ValueState[T]) Mutations() ([]internal.StateMutation, error) {
 	}}, nil
 }
 
+// Snapshot records the value so that the returned function can restore it.
+func (s *ValueState[T]) Snapshot() (restore func()) {
+	value, status, restoreClock := s.value, s.status, s.writeClock.snapshot()
+	return func() {
+		s.value, s.status = value, status
+		restoreClock()
+	}
+}
+
 func (s *ValueState[T]) Name() string {
 	return s.name
 }
@@ -78,6 +98,7 @@ func (s *ValueState[T]) Value() T {
 func (s *ValueState[T]) Set(value T) {
 	s.status = statusUpdated
 	s.value = value
+	s.recordWrite([]byte(s.name))
 }
 
 func (s *ValueState[T]) Drop() {
@@ -95,6 +116,7 @@ func NewValueState[T any](name string, codec ValueCodec[T]) *ValueState[T] {
 
 // Ensure ValueState implements StateItem
 var _ internal.StateItem = (*ValueState[int])(nil)
+var _ internal.Snapshotter = (*ValueState[int])(nil)
 
 // ScalarValueCodec is a codec for simple scalar values using protobuf serialization
 type ScalarValueCodec[T ProtoScalar] struct{}
@@ -89,6 +89,26 @@ func TestValueState_IncrementMultipleEvents(t *testing.T) {
 	assert.Equal(t, 2, decodedValue, "mutation should contain final value of 2")
 }
 
+func TestValueState_SnapshotRestoresValue(t *testing.T) {
+	v := NewValueState("test-snapshot", ScalarValueCodec[int]{})
+	err := v.Load([]internal.StateEntry{})
+	assert.NoError(t, err, "loading empty state should not error")
+
+	// A restored snapshot of unchanged state has no mutations
+	restore := v.Snapshot()
+	v.Set(1)
+	restore()
+	mutations, err := v.Mutations()
+	assert.NoError(t, err, "getting mutations should not error")
+	assert.Empty(t, mutations, "restored state should have no mutations")
+
+	v.Set(2)
+	restore = v.Snapshot()
+	v.Drop()
+	restore()
+	assert.Equal(t, 2, v.Value(), "value should be restored after drop")
+}
+
 // testValueStateRoundTrip is a helper function that tests the complete round-trip of a ValueState:
 // 1. Initialize with empty state
 // 2. Set a value and get mutations
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"maps"
 	"slices"
 	"sort"
 	"time"
@@ -32,14 +33,60 @@ type Subject struct {
 	usedStates map[string]LazyMutations
 	// Cache of loaded state instances
 	loadedStates map[string]any
+	// The checkpoint that a failed event rolls back to, if any
+	checkpointed *subjectCheckpoint
+	// Timers set by the SDK, loaded on first use
+	timerRegistry *timerRegistry
+	// Whether to record handler timers in the registry, which is needed when
+	// the operator sets system timers that could share a handler timer's
+	// timestamp
+	recordTimers bool
+	// The wall clock time when the batch started
+	processingTime time.Time
+	// The first error recorded by an SDK method that can't return one
+	err error
 }
 
+// NewSubject creates a subject for a key with its stored state entries by
+// state ID. Subjects are usually created for a batch but can also be used
+// directly to read or seed a key's state in tests.
+func NewSubject(key []byte, state map[string][]StateEntry, timestamp, watermark, processingTime time.Time) *Subject {
+	return &Subject{
+		key:            key,
+		timestamp:      timestamp,
+		watermark:      watermark,
+		state:          state,
+		stateMutations: make(map[string][]StateMutation),
+		usedStates:     make(map[string]LazyMutations),
+		loadedStates:   make(map[string]any),
+		processingTime: processingTime,
+	}
+}
+
+// TimeDomain selects the clock used to measure time.
+type TimeDomain int
+
+const (
+	// EventTime is measured by the watermark.
+	EventTime TimeDomain = iota
+	// ProcessingTime is measured by the handler's wall clock.
+	ProcessingTime
+)
+
 // LoadedState returns a previously loaded state instance for the given ID, or nil if not found
 func (s *Subject) LoadedState(id string) any {
 	if s.loadedStates == nil {
 		return nil
 	}
-	return s.loadedStates[id]
+	state := s.loadedStates[id]
+	if cp := s.checkpointed; state != nil && cp != nil {
+		if _, ok := cp.restores[id]; !ok {
+			if snapshotter, ok := state.(Snapshotter); ok {
+				cp.restores[id] = snapshotter.Snapshot()
+			}
+		}
+	}
+	return state
 }
 
 // StoreLoadedState stores a loaded state instance for later reuse
@@ -48,6 +95,23 @@ func (s *Subject) StoreLoadedState(id string, state any) {
 		s.loadedStates = make(map[string]any)
 	}
 	s.loadedStates[id] = state
+	if cp := s.checkpointed; cp != nil {
+		if _, ok := cp.restores[id]; !ok {
+			// Loaded after the checkpoint so a rollback loads it again
+			cp.restores[id] = func() {
+				delete(s.loadedStates, id)
+				delete(s.usedStates, id)
+			}
+		}
+	}
+}
+
+// Snapshotter is implemented by states that can undo their changes when a
+// failed event is rolled back.
+type Snapshotter interface {
+	// Snapshot records the state's pending changes and returns a function that
+	// restores them.
+	Snapshot() (restore func())
 }
 
 type contextKey string
@@ -80,9 +144,104 @@ type StateEntry struct {
 }
 
 // Register a timer that will trigger the OnTimerExpired when the watermark
-// passes the timer.
+// passes the timer. Setting the same timer more than once has no effect.
 func (s *Subject) SetTimer(timestamp time.Time) {
-	s.timers = append(s.timers, timestamp)
+	if registry := s.registry(s.recordTimers); registry != nil {
+		registry.remove(timestamp, timerCanceled)
+		if s.recordTimers || registry.has(timestamp, timerSystem) {
+			registry.add(timestamp, timerUser)
+		}
+	}
+	s.addTimer(timestamp)
+}
+
+// DeleteTimer cancels a timer previously set with SetTimer so that
+// OnTimerExpired isn't called for it. Timers set during the current batch are
+// removed outright. Timers from earlier batches remain with the engine and are
+// recorded as deleted until they fire.
+func (s *Subject) DeleteTimer(timestamp time.Time) {
+	registry := s.registry(true)
+	setInBatch := slices.ContainsFunc(s.timers, timestamp.Equal)
+	registry.remove(timestamp, timerUser)
+	switch {
+	case registry.isStored(timestamp) || !setInBatch:
+		registry.add(timestamp, timerCanceled)
+	case !s.recordTimers:
+		// Without recorded handler timers, a timer set in this batch may also
+		// have been set in an earlier one. It stays with the engine so that
+		// firing it removes the mark.
+		registry.add(timestamp, timerCanceled)
+		return
+	}
+	if !registry.has(timestamp, timerSystem) {
+		s.timers = slices.DeleteFunc(s.timers, timestamp.Equal)
+	}
+}
+
+// SetSystemTimer registers a timer owned by the SDK. When it fires, the
+// handler's OnTimerExpired is only called if the handler set the same timer.
+func (s *Subject) SetSystemTimer(timestamp time.Time) {
+	registry := s.registry(true)
+	if registry.has(timestamp, timerSystem) {
+		return
+	}
+	registry.add(timestamp, timerSystem)
+	s.addTimer(timestamp)
+}
+
+// TakeTimer removes an expired timer from the registry, including a deleted
+// timer's mark. It reports whether the timer was set with SetSystemTimer and
+// whether the handler's OnTimerExpired should be called for it.
+func (s *Subject) TakeTimer(timestamp time.Time) (system bool, callHandler bool) {
+	registry := s.registry(false)
+	if registry == nil {
+		return false, true
+	}
+	flags := registry.take(timestamp)
+	if flags == 0 {
+		return false, true
+	}
+	return flags&timerSystem != 0, flags&timerUser != 0
+}
+
+// addTimer adds a timer to send to the engine unless it was already added.
+func (s *Subject) addTimer(timestamp time.Time) {
+	if !slices.ContainsFunc(s.timers, timestamp.Equal) {
+		s.timers = append(s.timers, timestamp)
+	}
+}
+
+// registry returns the subject's timer registry, loading it from state. When
+// create is false and the key has no registered timers, registry returns nil.
+func (s *Subject) registry(create bool) *timerRegistry {
+	if s.timerRegistry != nil {
+		return s.timerRegistry
+	}
+	entries := s.state[TimerRegistryStateID]
+	if len(entries) == 0 && !create {
+		return nil
+	}
+	registry := newTimerRegistry()
+	if err := registry.Load(entries); err != nil {
+		s.Fail(&StateError{Key: s.key, StateID: TimerRegistryStateID, Err: err})
+		registry = newTimerRegistry()
+	}
+	s.timerRegistry = registry
+	return registry
+}
+
+// Fail records an error from an SDK method that has no error return, such as
+// loading state or collecting a sink value. The handler returns the first
+// recorded error after the current event or timer.
+func (s *Subject) Fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Err returns the first error recorded with Fail.
+func (s *Subject) Err() error {
+	return s.err
 }
 
 // Get the current subject's key
@@ -100,6 +259,19 @@ func (s *Subject) Watermark() time.Time {
 	return s.watermark
 }
 
+// ProcessingTime returns the wall clock time when the current batch started.
+func (s *Subject) ProcessingTime() time.Time {
+	return s.processingTime
+}
+
+// CurrentTime returns the current time in the given time domain.
+func (s *Subject) CurrentTime(domain TimeDomain) time.Time {
+	if domain == ProcessingTime {
+		return s.processingTime
+	}
+	return s.watermark
+}
+
 func (s *Subject) LoadState(stateItem StateItem) error {
 	// Get base state entries
 	stateEntries := s.state[stateItem.Name()]
@@ -110,31 +282,7 @@ func (s *Subject) LoadState(stateItem StateItem) error {
 		if err != nil {
 			return err
 		}
-
-		// Create a map of existing entries
-		entryMap := make(map[string]StateEntry)
-		for _, entry := range stateEntries {
-			entryMap[string(entry.Key)] = entry
-		}
-
-		// Apply previous mutations
-		for _, mutation := range prevMutations {
-			switch typed := mutation.(type) {
-			case *PutMutation:
-				entryMap[string(typed.Key)] = StateEntry{
-					Key:   typed.Key,
-					Value: typed.Value,
-				}
-			case *DeleteMutation:
-				delete(entryMap, string(typed.Key))
-			}
-		}
-
-		// Convert back to slice
-		stateEntries = make([]StateEntry, 0, len(entryMap))
-		for _, entry := range entryMap {
-			stateEntries = append(stateEntries, entry)
-		}
+		stateEntries = applyMutations(stateEntries, prevMutations)
 	}
 
 	return stateItem.Load(stateEntries)
@@ -153,66 +301,126 @@ func (s *Subject) UpdateState(state StateItem) error {
 	}
 	name := state.Name()
 
-	// Create a map of existing entries by key
-	entryMap := make(map[string]StateEntry)
-	for _, entry := range currentStateEntries {
+	newEntries := applyMutations(currentStateEntries, mutations)
+
+	// Update the state map
+	s.state[name] = newEntries
+	s.stateMutations[name] = append(s.stateMutations[name], mutations...)
+	return nil
+}
+
+// applyMutations returns the entries after the mutations, sorted by key.
+func applyMutations(entries []StateEntry, mutations []StateMutation) []StateEntry {
+	entryMap := make(map[string]StateEntry, len(entries))
+	for _, entry := range entries {
 		entryMap[string(entry.Key)] = entry
 	}
-
-	// Apply mutations to the entry map
 	for _, mutation := range mutations {
 		switch typed := mutation.(type) {
 		case *PutMutation:
-			entryMap[string(typed.Key)] = StateEntry{
-				Key:   typed.Key,
-				Value: typed.Value,
-			}
+			entryMap[string(typed.Key)] = StateEntry{Key: typed.Key, Value: typed.Value}
 		case *DeleteMutation:
 			delete(entryMap, string(typed.Key))
 		}
 	}
 
-	// Convert map back to slice
-	newEntries := make([]StateEntry, 0, len(entryMap))
+	applied := make([]StateEntry, 0, len(entryMap))
 	for _, entry := range entryMap {
-		newEntries = append(newEntries, entry)
+		applied = append(applied, entry)
 	}
-	slices.SortFunc(newEntries, func(a, b StateEntry) int {
+	slices.SortFunc(applied, func(a, b StateEntry) int {
 		return bytes.Compare(a.Key, b.Key)
 	})
+	return applied
+}
 
-	// Update the state map
-	s.state[name] = newEntries
-	s.stateMutations[name] = append(s.stateMutations[name], mutations...)
-	return nil
+// subjectCheckpoint is a subject's changes at a point in a batch. States are
+// snapshotted when first used after the checkpoint so that an event only pays
+// for the states it touches.
+type subjectCheckpoint struct {
+	restores      map[string]func() // by state ID
+	timers        []time.Time
+	timerRegistry *timerRegistry
+	sinkRequests  int
+}
+
+// checkpoint records the subject's changes so far so that a later rollback
+// can discard the changes made after it. The checkpoint is active until the
+// next checkpoint, rollback, or release.
+func (s *Subject) checkpoint() {
+	s.checkpointed = &subjectCheckpoint{
+		restores:      make(map[string]func()),
+		timers:        slices.Clone(s.timers),
+		timerRegistry: s.timerRegistry.clone(),
+		sinkRequests:  len(s.sinkRequests),
+	}
+}
+
+// rollback discards the state changes, timers, and sink requests made since
+// the active checkpoint.
+func (s *Subject) rollback() {
+	cp := s.checkpointed
+	s.checkpointed = nil
+	for _, restore := range cp.restores {
+		restore()
+	}
+	s.timers = cp.timers
+	s.timerRegistry = cp.timerRegistry
+	s.sinkRequests = s.sinkRequests[:cp.sinkRequests]
+}
+
+// release keeps the changes made since the active checkpoint.
+func (s *Subject) release() {
+	s.checkpointed = nil
 }
 
 func (s *Subject) AddSinkRequest(sinkID string, event []byte) {
 	s.sinkRequests = append(s.sinkRequests, &handlerpb.SinkRequest{Id: sinkID, Value: event})
 }
 
-func (s *Subject) encode() *handlerpb.KeyResult {
-	ret := &handlerpb.KeyResult{Key: s.key}
-	ret.NewTimers = make([]*timestamppb.Timestamp, len(s.timers))
-	for i, t := range s.timers {
-		ret.NewTimers[i] = timestamppb.New(t)
+// Encode returns the state mutations and new timers from using the subject.
+// Most callers instead get key results from a batch response.
+func (s *Subject) Encode() (*handlerpb.KeyResult, error) {
+	if err := s.Err(); err != nil {
+		return nil, err
 	}
+	return s.encode()
+}
+
+func (s *Subject) encode() (*handlerpb.KeyResult, error) {
+	ret := &handlerpb.KeyResult{Key: s.key}
 
 	// Collect mutations from all used states
 	allMutations := make(map[string][]StateMutation)
 	for stateID, mutations := range s.usedStates {
 		mutations, err := mutations()
 		if err != nil {
-			// Since encode is called internally and errors here would indicate a serious problem,
-			// we'll maintain the existing pattern of panicking on state errors
-			panic(fmt.Sprintf("failed to get mutations for state %s: %v", stateID, err))
+			return nil, &StateError{Key: s.key, StateID: stateID, Err: err}
 		}
 		allMutations[stateID] = mutations
 	}
 
+	// Computing state mutations may set system timers so the registry and
+	// timers are collected afterwards.
+	if s.timerRegistry != nil {
+		mutations, err := s.timerRegistry.Mutations()
+		if err != nil {
+			return nil, &StateError{Key: s.key, StateID: TimerRegistryStateID, Err: err}
+		}
+		if len(mutations) > 0 {
+			allMutations[TimerRegistryStateID] = mutations
+		}
+	}
+
+	ret.NewTimers = make([]*timestamppb.Timestamp, len(s.timers))
+	for i, t := range s.timers {
+		ret.NewTimers[i] = timestamppb.New(t)
+	}
+
 	ret.StateMutationNamespaces = make([]*handlerpb.StateMutationNamespace, len(allMutations))
 	var idx int
-	for ns, mutations := range allMutations {
+	for _, ns := range slices.Sorted(maps.Keys(allMutations)) {
+		mutations := allMutations[ns]
 		// Coalesce mutations by key
 		latest := make(map[string]StateMutation)
 		for _, m := range mutations {
@@ -267,7 +475,7 @@ func (s *Subject) encode() *handlerpb.KeyResult {
 		idx++
 	}
 
-	return ret
+	return ret, nil
 }
 
 type LazyMutations = func() ([]StateMutation, error)
@@ -7,12 +7,16 @@ import (
 )
 
 type lazySubjectBatch struct {
-	subjects  map[string]*Subject                // <subject-key>:<subject>
-	state     map[string]map[string][]StateEntry // <subject-key>:<state-id>:<state-entries>
-	watermark time.Time
+	subjects       map[string]*Subject                // <subject-key>:<subject>
+	order          []*Subject                         // subjects in the order they were first used
+	state          map[string]map[string][]StateEntry // <subject-key>:<state-id>:<state-entries>
+	watermark      time.Time
+	processingTime time.Time
+	// Whether subjects record handler timers in their timer registry
+	recordTimers bool
 }
 
-func NewLazySubjectBatch(keyStates []*handlerpb.KeyState, watermark time.Time) *lazySubjectBatch {
+func NewLazySubjectBatch(keyStates []*handlerpb.KeyState, watermark time.Time, processingTime time.Time) *lazySubjectBatch {
 	state := make(map[string]map[string][]StateEntry, len(keyStates))
 	for _, keyState := range keyStates {
 		// Initialize inner map for this key
@@ -27,9 +31,10 @@ func NewLazySubjectBatch(keyStates []*handlerpb.KeyState, watermark time.Time) *
 	}
 
 	return &lazySubjectBatch{
-		subjects:  make(map[string]*Subject),
-		state:     state,
-		watermark: watermark,
+		subjects:       make(map[string]*Subject),
+		state:          state,
+		watermark:      watermark,
+		processingTime: processingTime,
 	}
 }
 
@@ -38,26 +43,24 @@ func (sb *lazySubjectBatch) SubjectFor(key []byte, timestamp time.Time) *Subject
 		subject.timestamp = timestamp
 		return subject
 	}
-	subject := &Subject{
-		key:            key,
-		timestamp:      timestamp,
-		watermark:      sb.watermark,
-		state:          sb.stateForKey(key),
-		stateMutations: make(map[string][]StateMutation),
-		usedStates:     make(map[string]LazyMutations),
-		loadedStates:   make(map[string]any),
-	}
+	subject := NewSubject(key, sb.stateForKey(key), timestamp, sb.watermark, sb.processingTime)
+	subject.recordTimers = sb.recordTimers
 	sb.subjects[string(key)] = subject
+	sb.order = append(sb.order, subject)
 	return subject
 }
 
-func (sb *lazySubjectBatch) Response() *handlerpb.ProcessEventBatchResponse {
+func (sb *lazySubjectBatch) Response() (*handlerpb.ProcessEventBatchResponse, error) {
 	resp := &handlerpb.ProcessEventBatchResponse{}
-	for _, subject := range sb.subjects {
+	for _, subject := range sb.order {
+		keyResult, err := subject.encode()
+		if err != nil {
+			return nil, err
+		}
 		resp.SinkRequests = append(resp.SinkRequests, subject.sinkRequests...)
-		resp.KeyResults = append(resp.KeyResults, subject.encode())
+		resp.KeyResults = append(resp.KeyResults, keyResult)
 	}
-	return resp
+	return resp, nil
 }
 
 func (sb *lazySubjectBatch) stateForKey(key []byte) map[string][]StateEntry {
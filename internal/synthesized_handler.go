@@ -1,7 +1,13 @@
 package internal
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
 
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"reduction.dev/reduction-protocol/handlerpb"
@@ -10,6 +16,42 @@ import (
 type SynthesizedHandler struct {
 	KeyEventFunc    func(ctx context.Context, record []byte) ([]KeyedEvent, error)
 	OperatorHandler OperatorHandler
+	StateExpirers   []StateExpirer
+	// Optional handler for events that fail in KeyEvent or OnEvent. Without
+	// it, and for retryable errors, these errors fail the whole batch.
+	DeadLetterHandler DeadLetterHandler
+	// The number of keys to process concurrently in a batch. Values of 0 or 1
+	// process events sequentially.
+	KeyWorkers int
+	// Optional hooks called for each batch
+	BatchHooks BatchHooks
+	// Optional hooks called when the handler starts and stops
+	Lifecycle Lifecycle
+	// Returns the processing time for each batch. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Open prepares the operator handler to process events.
+func (s *SynthesizedHandler) Open(ctx context.Context) error {
+	if s.Lifecycle == nil {
+		return nil
+	}
+	if err := s.Lifecycle.Open(ctx); err != nil {
+		return fmt.Errorf("failed to open handler: %w", err)
+	}
+	return nil
+}
+
+// Close releases the operator handler's resources after it stops processing
+// events.
+func (s *SynthesizedHandler) Close(ctx context.Context) error {
+	if s.Lifecycle == nil {
+		return nil
+	}
+	if err := s.Lifecycle.Close(ctx); err != nil {
+		return fmt.Errorf("failed to close handler: %w", err)
+	}
+	return nil
 }
 
 func (s *SynthesizedHandler) KeyEvent(ctx context.Context, record []byte) ([]KeyedEvent, error) {
@@ -17,51 +59,237 @@ func (s *SynthesizedHandler) KeyEvent(ctx context.Context, record []byte) ([]Key
 }
 
 func (s *SynthesizedHandler) ProcessEventBatch(ctx context.Context, req *handlerpb.ProcessEventBatchRequest) (*handlerpb.ProcessEventBatchResponse, error) {
-	subjectBatch := NewLazySubjectBatch(req.KeyStates, req.Watermark.AsTime())
-
-	for _, event := range req.Events {
-		switch typedEvent := event.Event.(type) {
-		case *handlerpb.Event_KeyedEvent:
-			subject := subjectBatch.SubjectFor(typedEvent.KeyedEvent.Key, typedEvent.KeyedEvent.Timestamp.AsTime())
-			ctx = ContextWithSubject(ctx, subject)
-			if err := s.OperatorHandler.OnEvent(ctx, subject, KeyedEvent{
-				Key:       typedEvent.KeyedEvent.Key,
-				Timestamp: typedEvent.KeyedEvent.Timestamp.AsTime(),
-				Value:     typedEvent.KeyedEvent.Value,
-			}); err != nil {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	subjectBatch := NewLazySubjectBatch(req.KeyStates, req.Watermark.AsTime(), now())
+	// Expiring state sets system timers, which must not hide handler timers set
+	// for the same time.
+	subjectBatch.recordTimers = len(s.StateExpirers) > 0
+
+	hooks := s.BatchHooks
+	var batch Batch
+	if hooks != nil {
+		batch = newBatch(req)
+		if err := hooks.OnBatchStart(ctx, batch); err != nil {
+			return nil, NewUserError(err)
+		}
+	}
+
+	if s.KeyWorkers > 1 {
+		if err := s.processKeysConcurrently(ctx, subjectBatch, req.Events); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, event := range req.Events {
+			key, timestamp := eventKey(event)
+			if err := s.processEvent(ctx, subjectBatch.SubjectFor(key, timestamp), event); err != nil {
 				return nil, err
 			}
-		case *handlerpb.Event_TimerExpired:
-			subject := subjectBatch.SubjectFor(typedEvent.TimerExpired.Key, typedEvent.TimerExpired.Timestamp.AsTime())
-			ctx = ContextWithSubject(ctx, subject)
-			if err := s.OperatorHandler.OnTimerExpired(ctx, subject, typedEvent.TimerExpired.Timestamp.AsTime()); err != nil {
-				return nil, err
+		}
+	}
+
+	if hooks != nil {
+		if err := hooks.OnBatchEnd(ctx, batch); err != nil {
+			return nil, NewUserError(err)
+		}
+	}
+	return subjectBatch.Response()
+}
+
+// processKeysConcurrently partitions events by key and processes the keys with
+// a pool of KeyWorkers goroutines. Each key's events are processed in order.
+// If several keys fail, the error for the earliest event in the batch is
+// returned.
+func (s *SynthesizedHandler) processKeysConcurrently(ctx context.Context, subjectBatch *lazySubjectBatch, events []*handlerpb.Event) error {
+	type keyEvents struct {
+		subject  *Subject
+		events   []*handlerpb.Event
+		indexes  []int // batch positions of events
+		errIndex int
+		err      error
+	}
+
+	// Subjects are created up front because the batch isn't safe for
+	// concurrent use.
+	var partitions []*keyEvents
+	byKey := make(map[string]*keyEvents)
+	for i, event := range events {
+		key, timestamp := eventKey(event)
+		partition, ok := byKey[string(key)]
+		if !ok {
+			partition = &keyEvents{subject: subjectBatch.SubjectFor(key, timestamp)}
+			byKey[string(key)] = partition
+			partitions = append(partitions, partition)
+		}
+		partition.events = append(partition.events, event)
+		partition.indexes = append(partition.indexes, i)
+	}
+
+	work := make(chan *keyEvents)
+	var wg sync.WaitGroup
+	for range min(s.KeyWorkers, len(partitions)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partition := range work {
+				s.processPartition(ctx, partition.subject, partition.events, func(i int, err error) {
+					partition.errIndex, partition.err = partition.indexes[i], err
+				})
+			}
+		}()
+	}
+	for _, partition := range partitions {
+		work <- partition
+	}
+	close(work)
+	wg.Wait()
+
+	var failed *keyEvents
+	for _, partition := range partitions {
+		if partition.err != nil && (failed == nil || partition.errIndex < failed.errIndex) {
+			failed = partition
+		}
+	}
+	if failed != nil {
+		return failed.err
+	}
+	return nil
+}
+
+// processPartition processes one key's events in order on a worker goroutine,
+// stopping at the first error. A panic is recovered and reported as the error
+// of the event that caused it because nothing above the worker can recover it.
+func (s *SynthesizedHandler) processPartition(ctx context.Context, subject *Subject, events []*handlerpb.Event, fail func(i int, err error)) {
+	var i int
+	defer func() {
+		if value := recover(); value != nil {
+			fail(i, &PanicError{Value: value, Stack: debug.Stack()})
+		}
+	}()
+	for ; i < len(events); i++ {
+		_, subject.timestamp = eventKey(events[i])
+		if err := s.processEvent(ctx, subject, events[i]); err != nil {
+			fail(i, err)
+			return
+		}
+	}
+}
+
+// processEvent handles a single keyed event or timer for the subject.
+func (s *SynthesizedHandler) processEvent(ctx context.Context, subject *Subject, event *handlerpb.Event) error {
+	ctx = ContextWithSubject(ctx, subject)
+	switch typedEvent := event.Event.(type) {
+	case *handlerpb.Event_KeyedEvent:
+		if s.DeadLetterHandler != nil && bytes.Equal(typedEvent.KeyedEvent.Key, deadLetterKey) {
+			var letter DeadLetter
+			if err := json.Unmarshal(typedEvent.KeyedEvent.Value, &letter); err != nil {
+				return fmt.Errorf("failed to decode dead letter: %w", err)
+			}
+			s.DeadLetterHandler(ctx, subject, letter)
+			return subject.Err()
+		}
+		event := KeyedEvent{
+			Key:       typedEvent.KeyedEvent.Key,
+			Timestamp: typedEvent.KeyedEvent.Timestamp.AsTime(),
+			Value:     typedEvent.KeyedEvent.Value,
+		}
+		if s.DeadLetterHandler != nil {
+			subject.checkpoint()
+			defer subject.release()
+		}
+		if err := s.OperatorHandler.OnEvent(ctx, subject, event); err != nil {
+			// Retryable errors fail the batch so that the engine retries it
+			// rather than dropping the event.
+			if s.DeadLetterHandler == nil || ErrorKindOf(err) == ErrorKindRetryable {
+				return NewUserError(err)
+			}
+			// Discard the failed call's state changes, timers, and sink values
+			// so that the event isn't partly applied.
+			subject.rollback()
+			s.DeadLetterHandler(ctx, subject, DeadLetter{
+				Record:    event.Value,
+				Key:       event.Key,
+				Timestamp: event.Timestamp,
+				Error:     ErrorMessage(err),
+			})
+		}
+		return subject.Err()
+	case *handlerpb.Event_TimerExpired:
+		system, callHandler := subject.TakeTimer(typedEvent.TimerExpired.Timestamp.AsTime())
+		if system {
+			for _, expire := range s.StateExpirers {
+				expire(subject)
+			}
+			if err := subject.Err(); err != nil {
+				return err
 			}
 		}
+		if !callHandler {
+			return nil
+		}
+		if err := s.OperatorHandler.OnTimerExpired(ctx, subject, typedEvent.TimerExpired.Timestamp.AsTime()); err != nil {
+			return NewUserError(err)
+		}
+		return subject.Err()
 	}
+	return nil
+}
 
-	return subjectBatch.Response(), nil
+// eventKey returns the key and timestamp of a keyed event or timer.
+func eventKey(event *handlerpb.Event) ([]byte, time.Time) {
+	switch typedEvent := event.Event.(type) {
+	case *handlerpb.Event_KeyedEvent:
+		return typedEvent.KeyedEvent.Key, typedEvent.KeyedEvent.Timestamp.AsTime()
+	case *handlerpb.Event_TimerExpired:
+		return typedEvent.TimerExpired.Key, typedEvent.TimerExpired.Timestamp.AsTime()
+	}
+	return nil, time.Time{}
 }
 
 func (s *SynthesizedHandler) KeyEventBatch(ctx context.Context, req *handlerpb.KeyEventBatchRequest) (*handlerpb.KeyEventBatchResponse, error) {
 	results := make([]*handlerpb.KeyEventResult, len(req.Values))
+	failures := make(map[int]error)
+	var latest time.Time
 	for valueIdx, value := range req.Values {
 		keyedEvents, err := s.KeyEvent(ctx, value)
 		if err != nil {
-			return nil, err
+			if s.DeadLetterHandler == nil || ErrorKindOf(err) == ErrorKindRetryable {
+				return nil, NewUserError(err)
+			}
+			failures[valueIdx] = err
+			continue
 		}
-
-		pbKeyedEvents := make([]*handlerpb.KeyedEvent, len(keyedEvents))
-		for eventIdx, event := range keyedEvents {
-			pbKeyedEvents[eventIdx] = &handlerpb.KeyedEvent{
-				Key:       event.Key,
-				Value:     event.Value,
-				Timestamp: timestamppb.New(event.Timestamp),
+		for _, event := range keyedEvents {
+			if event.Timestamp.After(latest) {
+				latest = event.Timestamp
 			}
 		}
+		results[valueIdx] = keyEventResult(keyedEvents)
+	}
 
-		results[valueIdx] = &handlerpb.KeyEventResult{Events: pbKeyedEvents}
+	// Failed records take the latest event time of the batch so that they
+	// don't advance the watermark.
+	for valueIdx, keyErr := range failures {
+		deadLetterEvent, err := newDeadLetterEvent(req.Values[valueIdx], latest, keyErr)
+		if err != nil {
+			return nil, err
+		}
+		results[valueIdx] = keyEventResult([]KeyedEvent{deadLetterEvent})
 	}
 
 	return &handlerpb.KeyEventBatchResponse{Results: results}, nil
 }
+
+func keyEventResult(keyedEvents []KeyedEvent) *handlerpb.KeyEventResult {
+	pbKeyedEvents := make([]*handlerpb.KeyedEvent, len(keyedEvents))
+	for eventIdx, event := range keyedEvents {
+		pbKeyedEvents[eventIdx] = &handlerpb.KeyedEvent{
+			Key:       event.Key,
+			Value:     event.Value,
+			Timestamp: timestamppb.New(event.Timestamp),
+		}
+	}
+	return &handlerpb.KeyEventResult{Events: pbKeyedEvents}
+}
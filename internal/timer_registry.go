@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// TimerRegistryStateID is the reserved state namespace where the SDK tracks
+// timers that it sets on behalf of handlers and timers that handlers deleted.
+const TimerRegistryStateID = "rxn.timers"
+
+type timerFlags byte
+
+const (
+	// Set by the SDK, for instance to clean up expired state.
+	timerSystem timerFlags = 1 << iota
+	// Also set by the handler, which must be called when the timer fires.
+	timerUser
+	// Deleted by the handler, which must not be called when the timer fires.
+	timerCanceled
+)
+
+// timerRegistry is a state item mapping timer timestamps to flags describing
+// who set them. Engine timers carry only a timestamp and can't be deleted so
+// this is how the SDK tells its own timers and deleted timers apart from the
+// handler's. When an operator sets system timers, its handler timers are
+// recorded too so that a system timer at the same timestamp, possibly set in a
+// later batch, still calls the handler. Timers missing from the registry belong
+// to the handler.
+type timerRegistry struct {
+	timers  map[int64]timerFlags
+	changed map[int64]bool
+	// The timers loaded from state, which the engine already has
+	stored map[int64]bool
+}
+
+func newTimerRegistry() *timerRegistry {
+	return &timerRegistry{
+		timers:  make(map[int64]timerFlags),
+		changed: make(map[int64]bool),
+		stored:  make(map[int64]bool),
+	}
+}
+
+func (r *timerRegistry) has(ts time.Time, flag timerFlags) bool {
+	return r.timers[ts.UnixNano()]&flag != 0
+}
+
+// isStored reports whether the timer was in the registry loaded from state.
+func (r *timerRegistry) isStored(ts time.Time) bool {
+	return r.stored[ts.UnixNano()]
+}
+
+func (r *timerRegistry) add(ts time.Time, flag timerFlags) {
+	key := ts.UnixNano()
+	if r.timers[key]&flag != 0 {
+		return
+	}
+	r.timers[key] |= flag
+	r.changed[key] = true
+}
+
+func (r *timerRegistry) remove(ts time.Time, flag timerFlags) {
+	key := ts.UnixNano()
+	flags, ok := r.timers[key]
+	if !ok || flags&flag == 0 {
+		return
+	}
+	if flags &^= flag; flags == 0 {
+		delete(r.timers, key)
+	} else {
+		r.timers[key] = flags
+	}
+	r.changed[key] = true
+}
+
+// take removes the timer from the registry and returns its flags.
+func (r *timerRegistry) take(ts time.Time) timerFlags {
+	key := ts.UnixNano()
+	flags, ok := r.timers[key]
+	if ok {
+		delete(r.timers, key)
+		r.changed[key] = true
+	}
+	return flags
+}
+
+// clone returns a copy of the registry, or nil for a nil registry.
+func (r *timerRegistry) clone() *timerRegistry {
+	if r == nil {
+		return nil
+	}
+	return &timerRegistry{timers: maps.Clone(r.timers), changed: maps.Clone(r.changed), stored: r.stored}
+}
+
+func (r *timerRegistry) Name() string {
+	return TimerRegistryStateID
+}
+
+func (r *timerRegistry) Load(entries []StateEntry) error {
+	for _, entry := range entries {
+		if len(entry.Key) != 8 || len(entry.Value) != 1 {
+			return fmt.Errorf("invalid timer registry entry")
+		}
+		key := int64(binary.BigEndian.Uint64(entry.Key) ^ (1 << 63))
+		r.timers[key] = timerFlags(entry.Value[0])
+		r.stored[key] = true
+	}
+	return nil
+}
+
+func (r *timerRegistry) Mutations() ([]StateMutation, error) {
+	var mutations []StateMutation
+	for _, key := range slices.Sorted(maps.Keys(r.changed)) {
+		keyBytes := binary.BigEndian.AppendUint64(nil, uint64(key)^(1<<63))
+		if flags, ok := r.timers[key]; ok {
+			mutations = append(mutations, &PutMutation{Key: keyBytes, Value: []byte{byte(flags)}})
+		} else if r.stored[key] {
+			mutations = append(mutations, &DeleteMutation{Key: keyBytes})
+		}
+	}
+	return mutations, nil
+}
+
+var _ StateItem = (*timerRegistry)(nil)
@@ -0,0 +1,9 @@
+package rxn
+
+import (
+	"reduction.dev/reduction-go/internal"
+)
+
+// DeadLetter describes an event or source record that failed processing. Jobs
+// receive dead letters with [topology.Job.OnDeadLetter].
+type DeadLetter = internal.DeadLetter
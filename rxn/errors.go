@@ -0,0 +1,16 @@
+package rxn
+
+import "reduction.dev/reduction-go/internal"
+
+// RetryableError marks an error returned by a handler as a transient failure,
+// such as a timeout calling an external service, so that the engine retries
+// the batch.
+func RetryableError(err error) error {
+	return internal.NewRetryableError(err)
+}
+
+// BadInputError marks an error returned by a handler as caused by a record
+// that can't be processed.
+func BadInputError(err error) error {
+	return internal.NewBadInputError(err)
+}
@@ -0,0 +1,18 @@
+package rxn
+
+import "iter"
+
+type ListSpec[T any] interface {
+	StateFor(subject Subject) ListState[T]
+}
+
+// ListState is an append-only list of values. Only appended values and
+// removals are written back to storage.
+type ListState[T any] interface {
+	Append(value T)
+	All() iter.Seq[T]
+	Len() int
+	Clear()
+	// KeepLast removes values from the front of the list until at most n remain.
+	KeepLast(n int)
+}
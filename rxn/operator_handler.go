@@ -3,6 +3,8 @@ package rxn
 import (
 	"context"
 	"time"
+
+	"reduction.dev/reduction-go/internal"
 )
 
 // OperatorHandler defines the two methods operators implement to handle events
@@ -18,3 +20,38 @@ type OperatorHandler interface {
 	// after the timer's timestamp have likely already arrived.
 	OnTimerExpired(ctx context.Context, subject Subject, timer time.Time) error
 }
+
+// Batch describes the events in a batch passed to a [BatchHandler].
+type Batch = internal.Batch
+
+// BatchHandler is an optional extension of [OperatorHandler] for handlers that
+// work with whole batches, for instance to prefetch data for every key in a
+// batch with one call to an external service or to flush buffered side effects
+// once per batch.
+//
+// The context passed to these methods isn't scoped to a key so the methods
+// can't use state or sinks.
+type BatchHandler interface {
+	OperatorHandler
+
+	// Called before the batch's events and timers are processed.
+	OnBatchStart(ctx context.Context, batch Batch) error
+
+	// Called after all of the batch's events and timers were processed
+	// successfully.
+	OnBatchEnd(ctx context.Context, batch Batch) error
+}
+
+// LifecycleHandler is an optional extension of [OperatorHandler] for handlers
+// that manage resources, such as database connections or caches, for as long
+// as the handler runs.
+type LifecycleHandler interface {
+	OperatorHandler
+
+	// Called once before the handler processes any events. Returning an error
+	// stops the handler from starting.
+	Open(ctx context.Context) error
+
+	// Called once after the handler stops processing events.
+	Close(ctx context.Context) error
+}
@@ -3,6 +3,8 @@ package rxn_test
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/hex"
 	"net/http"
 	"net/http/httptest"
 	"slices"
@@ -416,6 +418,622 @@ func TestProcessEventBatch_IncrementValueState(t *testing.T) {
 	assertResponseEqual(t, want, got.Msg)
 }
 
+func TestProcessEventBatch_MapStateTTL(t *testing.T) {
+	now := time.Now().UTC()
+	var seen []string
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		stateSpec := topology.NewMapSpec(op, "test-state", MapStringIntCodec{}, topology.WithTTL(time.Minute, topology.EventTime))
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				for k := range stateSpec.StateFor(subject).All() {
+					seen = append(seen, k)
+				}
+				return nil
+			},
+		}
+	})
+
+	got, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(now),
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{
+				KeyedEvent: &handlerpb.KeyedEvent{
+					Key:       []byte("test-key"),
+					Timestamp: timestamppb.New(now),
+				},
+			},
+		}},
+		KeyStates: []*handlerpb.KeyState{{
+			Key: []byte("test-key"),
+			StateEntryNamespaces: []*handlerpb.StateEntryNamespace{{
+				Namespace: "test-state",
+				Entries: []*handlerpb.StateEntry{{
+					Key:   []byte("expired"),
+					Value: withWriteTime(now.Add(-time.Minute), 1),
+				}, {
+					Key:   []byte("live"),
+					Value: withWriteTime(now.Add(-time.Second), 2),
+				}},
+			}},
+		}},
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"live"}, seen, "expired entries are hidden")
+	want := &handlerpb.ProcessEventBatchResponse{
+		KeyResults: []*handlerpb.KeyResult{{
+			Key: []byte("test-key"),
+			StateMutationNamespaces: []*handlerpb.StateMutationNamespace{{
+				Namespace: "test-state",
+				Mutations: []*handlerpb.StateMutation{{
+					Mutation: &handlerpb.StateMutation_Delete{
+						Delete: &handlerpb.DeleteMutation{Key: []byte("expired")},
+					},
+				}},
+			}},
+		}},
+	}
+	assertResponseEqual(t, want, got.Msg)
+}
+
+func TestProcessEventBatch_TTLTimerDeletesStateWithoutCallingHandler(t *testing.T) {
+	now := time.Now().UTC()
+	var handlerTimers []time.Time
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		stateSpec := topology.NewValueSpec(op, "test-value", rxn.ScalarValueCodec[int]{}, topology.WithTTL(time.Minute, topology.EventTime))
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				stateSpec.StateFor(subject).Set(1)
+				return nil
+			},
+			onTimerExpiredFunc: func(ctx context.Context, subject rxn.Subject, timer time.Time) error {
+				handlerTimers = append(handlerTimers, timer)
+				return nil
+			},
+		}
+	})
+
+	// Writing the value sets the TTL timer
+	written, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(now),
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{
+				KeyedEvent: &handlerpb.KeyedEvent{
+					Key:       []byte("test-key"),
+					Timestamp: timestamppb.New(now),
+				},
+			},
+		}},
+	}))
+	require.NoError(t, err)
+	require.Len(t, written.Msg.KeyResults, 1)
+	assert.Equal(t, []*timestamppb.Timestamp{timestamppb.New(now.Add(time.Minute))}, written.Msg.KeyResults[0].NewTimers)
+
+	// Firing the TTL timer deletes the value and the timer registration
+	got, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(now.Add(time.Minute)),
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_TimerExpired{
+				TimerExpired: &handlerpb.TimerExpired{
+					Key:       []byte("test-key"),
+					Timestamp: timestamppb.New(now.Add(time.Minute)),
+				},
+			},
+		}},
+		KeyStates: keyStatesFromResponse(written.Msg),
+	}))
+	require.NoError(t, err)
+
+	assert.Empty(t, handlerTimers, "handler should not receive TTL timers")
+	require.Len(t, got.Msg.KeyResults, 1)
+	deletes := make(map[string]int)
+	for _, ns := range got.Msg.KeyResults[0].StateMutationNamespaces {
+		for _, m := range ns.Mutations {
+			if m.GetDelete() != nil {
+				deletes[ns.Namespace]++
+			}
+		}
+	}
+	assert.Equal(t, map[string]int{"test-value": 1, "rxn.timers": 1}, deletes)
+}
+
+func TestProcessEventBatch_TTLTimerKeepsHandlerTimerFromEarlierBatch(t *testing.T) {
+	now := time.Now().UTC()
+	var handlerTimers []time.Time
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		stateSpec := topology.NewValueSpec(op, "test-value", rxn.ScalarValueCodec[int]{}, topology.WithTTL(time.Minute, topology.EventTime))
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				if string(event.Value) == "timer" {
+					subject.SetTimer(now.Add(time.Minute))
+				} else {
+					stateSpec.StateFor(subject).Set(1)
+				}
+				return nil
+			},
+			onTimerExpiredFunc: func(ctx context.Context, subject rxn.Subject, timer time.Time) error {
+				handlerTimers = append(handlerTimers, timer)
+				return nil
+			},
+		}
+	})
+
+	// The handler sets a timer in one batch
+	timerSet, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(now),
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{
+				Key:       []byte("test-key"),
+				Value:     []byte("timer"),
+				Timestamp: timestamppb.New(now),
+			}},
+		}},
+	}))
+	require.NoError(t, err)
+
+	// A later batch writes a value whose TTL timer has the same timestamp
+	written, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(now),
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{
+				Key:       []byte("test-key"),
+				Value:     []byte("write"),
+				Timestamp: timestamppb.New(now),
+			}},
+		}},
+		KeyStates: keyStatesFromResponse(timerSet.Msg),
+	}))
+	require.NoError(t, err)
+	require.Len(t, written.Msg.KeyResults, 1)
+	assert.Equal(t, []*timestamppb.Timestamp{timestamppb.New(now.Add(time.Minute))}, written.Msg.KeyResults[0].NewTimers)
+
+	_, err = client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(now.Add(time.Minute)),
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_TimerExpired{TimerExpired: &handlerpb.TimerExpired{
+				Key:       []byte("test-key"),
+				Timestamp: timestamppb.New(now.Add(time.Minute)),
+			}},
+		}},
+		KeyStates: keyStatesFromResponse(written.Msg),
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, []time.Time{now.Add(time.Minute)}, handlerTimers, "the handler's timer should still fire")
+}
+
+func TestProcessEventBatch_TTLStampsEachEntryWithItsWriteTime(t *testing.T) {
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		stateSpec := topology.NewMapSpec(op, "test-state", MapStringIntCodec{}, topology.WithTTL(time.Minute, topology.EventTime))
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				stateSpec.StateFor(subject).Set(string(event.Value), 1)
+				return nil
+			},
+		}
+	})
+
+	// Out of order events for one key write "x" at 100s and then "y" at 10s
+	written, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{
+				Key:       []byte("test-key"),
+				Value:     []byte("x"),
+				Timestamp: timestamppb.New(time.Unix(100, 0)),
+			}},
+		}, {
+			Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{
+				Key:       []byte("test-key"),
+				Value:     []byte("y"),
+				Timestamp: timestamppb.New(time.Unix(10, 0)),
+			}},
+		}},
+	}))
+	require.NoError(t, err)
+	require.Len(t, written.Msg.KeyResults, 1)
+	puts := make(map[string][]byte)
+	for _, ns := range written.Msg.KeyResults[0].StateMutationNamespaces {
+		if ns.Namespace != "test-state" {
+			continue
+		}
+		for _, m := range ns.Mutations {
+			puts[string(m.GetPut().Key)] = m.GetPut().Value
+		}
+	}
+	assert.Equal(t, map[string][]byte{
+		"x": withWriteTime(time.Unix(100, 0), 1),
+		"y": withWriteTime(time.Unix(10, 0), 1),
+	}, puts)
+	assert.Equal(t, []*timestamppb.Timestamp{timestamppb.New(time.Unix(70, 0))}, written.Msg.KeyResults[0].NewTimers,
+		"the timer is set for the earliest entry to expire")
+
+	// At watermark 80s only "y" has expired
+	got, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(time.Unix(80, 0)),
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_TimerExpired{TimerExpired: &handlerpb.TimerExpired{
+				Key:       []byte("test-key"),
+				Timestamp: timestamppb.New(time.Unix(70, 0)),
+			}},
+		}},
+		KeyStates: keyStatesFromResponse(written.Msg),
+	}))
+	require.NoError(t, err)
+	require.Len(t, got.Msg.KeyResults, 1)
+	var deleted []string
+	for _, ns := range got.Msg.KeyResults[0].StateMutationNamespaces {
+		if ns.Namespace != "test-state" {
+			continue
+		}
+		for _, m := range ns.Mutations {
+			if m.GetDelete() != nil {
+				deleted = append(deleted, string(m.GetDelete().Key))
+			}
+		}
+	}
+	assert.Equal(t, []string{"y"}, deleted)
+	assert.Equal(t, []*timestamppb.Timestamp{timestamppb.New(time.Unix(160, 0))}, got.Msg.KeyResults[0].NewTimers,
+		"the next timer is set for the remaining entry")
+}
+
+func TestProcessEventBatch_DeduplicatesTimers(t *testing.T) {
+	now := time.Now().UTC()
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				subject.SetTimer(now.Add(time.Hour))
+				return nil
+			},
+		}
+	})
+
+	event := &handlerpb.Event{
+		Event: &handlerpb.Event_KeyedEvent{
+			KeyedEvent: &handlerpb.KeyedEvent{
+				Key:       []byte("test-key"),
+				Timestamp: timestamppb.New(now),
+			},
+		},
+	}
+	got, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Events: []*handlerpb.Event{event, event},
+	}))
+	require.NoError(t, err)
+
+	want := &handlerpb.ProcessEventBatchResponse{
+		KeyResults: []*handlerpb.KeyResult{{
+			Key:       []byte("test-key"),
+			NewTimers: []*timestamppb.Timestamp{timestamppb.New(now.Add(time.Hour))},
+		}},
+	}
+	assertResponseEqual(t, want, got.Msg)
+}
+
+func TestProcessEventBatch_DeleteTimerSkipsExpiredTimer(t *testing.T) {
+	now := time.Now().UTC()
+	var handlerTimers []time.Time
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				// Push the deadline forward
+				subject.DeleteTimer(event.Timestamp)
+				subject.SetTimer(event.Timestamp.Add(time.Minute))
+				return nil
+			},
+			onTimerExpiredFunc: func(ctx context.Context, subject rxn.Subject, timer time.Time) error {
+				handlerTimers = append(handlerTimers, timer)
+				return nil
+			},
+		}
+	})
+
+	// The timer at now was set in an earlier batch and gets deleted
+	deleted, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(now.Add(-time.Minute)),
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{
+				KeyedEvent: &handlerpb.KeyedEvent{
+					Key:       []byte("test-key"),
+					Timestamp: timestamppb.New(now),
+				},
+			},
+		}},
+	}))
+	require.NoError(t, err)
+	require.Len(t, deleted.Msg.KeyResults, 1)
+	assert.Equal(t, []*timestamppb.Timestamp{timestamppb.New(now.Add(time.Minute))}, deleted.Msg.KeyResults[0].NewTimers)
+
+	_, err = client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(now.Add(time.Minute)),
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_TimerExpired{
+				TimerExpired: &handlerpb.TimerExpired{
+					Key:       []byte("test-key"),
+					Timestamp: timestamppb.New(now),
+				},
+			},
+		}, {
+			Event: &handlerpb.Event_TimerExpired{
+				TimerExpired: &handlerpb.TimerExpired{
+					Key:       []byte("test-key"),
+					Timestamp: timestamppb.New(now.Add(time.Minute)),
+				},
+			},
+		}},
+		KeyStates: keyStatesFromResponse(deleted.Msg),
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, []time.Time{now.Add(time.Minute)}, handlerTimers, "only the pushed-forward timer calls the handler")
+}
+
+func TestProcessEventBatch_DeleteTimerMarkOutlivesWatermark(t *testing.T) {
+	now := time.Now().UTC()
+	var handlerTimers []time.Time
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				if string(event.Value) == "delete" {
+					subject.DeleteTimer(now)
+				} else {
+					subject.SetTimer(now.Add(time.Hour))
+				}
+				return nil
+			},
+			onTimerExpiredFunc: func(ctx context.Context, subject rxn.Subject, timer time.Time) error {
+				handlerTimers = append(handlerTimers, timer)
+				return nil
+			},
+		}
+	})
+	keyedEvent := func(value string) *handlerpb.Event {
+		return &handlerpb.Event{Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{
+			Key:       []byte("test-key"),
+			Value:     []byte(value),
+			Timestamp: timestamppb.New(now),
+		}}}
+	}
+
+	deleted, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(now.Add(-time.Minute)),
+		Events:    []*handlerpb.Event{keyedEvent("delete")},
+	}))
+	require.NoError(t, err)
+
+	// The watermark passes the deleted timer before the engine delivers it
+	passed, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(now.Add(time.Minute)),
+		Events:    []*handlerpb.Event{keyedEvent("set")},
+		KeyStates: keyStatesFromResponse(deleted.Msg),
+	}))
+	require.NoError(t, err)
+	require.Len(t, passed.Msg.KeyResults, 1)
+	for _, ns := range passed.Msg.KeyResults[0].StateMutationNamespaces {
+		assert.NotEqual(t, "rxn.timers", ns.Namespace, "the deletion mark is kept until the timer fires")
+	}
+
+	fired, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(now.Add(time.Minute)),
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_TimerExpired{TimerExpired: &handlerpb.TimerExpired{
+				Key:       []byte("test-key"),
+				Timestamp: timestamppb.New(now),
+			}},
+		}},
+		KeyStates: keyStatesFromResponse(deleted.Msg),
+	}))
+	require.NoError(t, err)
+
+	assert.Empty(t, handlerTimers, "a late deleted timer should not call the handler")
+	require.Len(t, fired.Msg.KeyResults, 1)
+	require.Len(t, fired.Msg.KeyResults[0].StateMutationNamespaces, 1)
+	ns := fired.Msg.KeyResults[0].StateMutationNamespaces[0]
+	assert.Equal(t, "rxn.timers", ns.Namespace)
+	require.Len(t, ns.Mutations, 1)
+	assert.NotNil(t, ns.Mutations[0].GetDelete(), "firing the timer removes its deletion mark")
+}
+
+func TestProcessEventBatch_DeleteTimerSetInBatchLeavesNoMark(t *testing.T) {
+	now := time.Now().UTC()
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		// TTL state makes the operator record its handler timers
+		topology.NewValueSpec(op, "test-value", rxn.ScalarValueCodec[int]{}, topology.WithTTL(time.Minute, topology.EventTime))
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				subject.SetTimer(now.Add(time.Minute))
+				subject.DeleteTimer(now.Add(time.Minute))
+				return nil
+			},
+		}
+	})
+
+	got, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{
+				Key:       []byte("test-key"),
+				Timestamp: timestamppb.New(now),
+			}},
+		}},
+	}))
+	require.NoError(t, err)
+
+	require.Len(t, got.Msg.KeyResults, 1)
+	assert.Empty(t, got.Msg.KeyResults[0].NewTimers)
+	assert.Empty(t, got.Msg.KeyResults[0].StateMutationNamespaces, "the deleted timer never reached the engine")
+}
+
+func TestProcessEventBatch_ProcessingTime(t *testing.T) {
+	var processingTimes []time.Time
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				processingTimes = append(processingTimes, subject.ProcessingTime())
+				return nil
+			},
+		}
+	})
+
+	before := time.Now()
+	_, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{
+				KeyedEvent: &handlerpb.KeyedEvent{Key: []byte("key-1")},
+			},
+		}, {
+			Event: &handlerpb.Event_KeyedEvent{
+				KeyedEvent: &handlerpb.KeyedEvent{Key: []byte("key-2")},
+			},
+		}},
+	}))
+	require.NoError(t, err)
+
+	require.Len(t, processingTimes, 2)
+	assert.Equal(t, processingTimes[0], processingTimes[1], "all subjects in a batch share the processing time")
+	assert.WithinRange(t, processingTimes[0], before, time.Now())
+}
+
+func TestProcessEventBatch_CorruptStateReturnsStateError(t *testing.T) {
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		stateSpec := topology.NewValueSpec(op, "counter-state", rxn.ScalarValueCodec[int]{})
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				state := stateSpec.StateFor(subject)
+				state.Set(state.Value() + 1)
+				return nil
+			},
+		}
+	})
+
+	_, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{
+				KeyedEvent: &handlerpb.KeyedEvent{Key: []byte("test-key")},
+			},
+		}},
+		KeyStates: []*handlerpb.KeyState{{
+			Key: []byte("test-key"),
+			StateEntryNamespaces: []*handlerpb.StateEntryNamespace{{
+				Namespace: "counter-state",
+				Entries:   []*handlerpb.StateEntry{{Key: []byte("counter-state"), Value: []byte{0xff}}},
+			}},
+		}},
+	}))
+	var connectErr *connect.Error
+	require.ErrorAs(t, err, &connectErr)
+	assert.Equal(t, connect.CodeDataLoss, connectErr.Code())
+	assert.Equal(t, hex.EncodeToString([]byte("test-key")), connectErr.Meta().Get("Rxn-Error-Key"))
+	assert.Equal(t, "counter-state", connectErr.Meta().Get("Rxn-Error-State-Id"))
+}
+
+func TestProcessEventBatch_RecoversHandlerPanic(t *testing.T) {
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				panic("handler bug")
+			},
+		}
+	})
+
+	_, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{
+				KeyedEvent: &handlerpb.KeyedEvent{Key: []byte("test-key")},
+			},
+		}},
+	}))
+
+	var connectErr *connect.Error
+	require.ErrorAs(t, err, &connectErr)
+	assert.Equal(t, connect.CodeAborted, connectErr.Code())
+	assert.Equal(t, "user", connectErr.Meta().Get("Rxn-Error-Kind"))
+	assert.Contains(t, connectErr.Message(), "panic: handler bug")
+}
+
+func TestProcessEventBatch_RetryableError(t *testing.T) {
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		return &rxnHandler{
+			onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				return rxn.RetryableError(context.DeadlineExceeded)
+			},
+		}
+	})
+
+	_, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{
+				KeyedEvent: &handlerpb.KeyedEvent{Key: []byte("test-key")},
+			},
+		}},
+	}))
+
+	var connectErr *connect.Error
+	require.ErrorAs(t, err, &connectErr)
+	assert.Equal(t, connect.CodeUnavailable, connectErr.Code())
+	assert.Equal(t, "retryable", connectErr.Meta().Get("Rxn-Error-Kind"))
+	require.Len(t, connectErr.Details(), 1, "error should include a detail describing its kind")
+}
+
+func TestProcessEventBatch_BatchHandlerHooks(t *testing.T) {
+	var calls []string
+	_, client := setupTestServer(t, func(job *topology.Job, op *topology.Operator) rxn.OperatorHandler {
+		return &batchHandler{
+			rxnHandler: rxnHandler{
+				onEventFunc: func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+					calls = append(calls, "OnEvent "+string(event.Key))
+					return nil
+				},
+			},
+			onBatchStartFunc: func(ctx context.Context, batch rxn.Batch) error {
+				assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, batch.Keys)
+				assert.Len(t, batch.Events, 2)
+				calls = append(calls, "OnBatchStart")
+				return nil
+			},
+			onBatchEndFunc: func(ctx context.Context, batch rxn.Batch) error {
+				calls = append(calls, "OnBatchEnd")
+				return nil
+			},
+		}
+	})
+
+	_, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+		Events: []*handlerpb.Event{{
+			Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{Key: []byte("a")}},
+		}, {
+			Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{Key: []byte("b")}},
+		}, {
+			Event: &handlerpb.Event_TimerExpired{TimerExpired: &handlerpb.TimerExpired{Key: []byte("a")}},
+		}},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"OnBatchStart", "OnEvent a", "OnEvent b", "OnBatchEnd"}, calls)
+}
+
+// withWriteTime encodes a MapStringIntCodec value with a TTL write time prefix.
+func withWriteTime(ts time.Time, value int) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, uint64(ts.UnixNano())), byte(value))
+}
+
+// keyStatesFromResponse converts the put mutations of a response into the key
+// states for a following request.
+func keyStatesFromResponse(resp *handlerpb.ProcessEventBatchResponse) []*handlerpb.KeyState {
+	var keyStates []*handlerpb.KeyState
+	for _, kr := range resp.KeyResults {
+		keyState := &handlerpb.KeyState{Key: kr.Key}
+		for _, ns := range kr.StateMutationNamespaces {
+			entryNamespace := &handlerpb.StateEntryNamespace{Namespace: ns.Namespace}
+			for _, m := range ns.Mutations {
+				if put := m.GetPut(); put != nil {
+					entryNamespace.Entries = append(entryNamespace.Entries, &handlerpb.StateEntry{Key: put.Key, Value: put.Value})
+				}
+			}
+			keyState.StateEntryNamespaces = append(keyState.StateEntryNamespaces, entryNamespace)
+		}
+		keyStates = append(keyStates, keyState)
+	}
+	return keyStates
+}
+
 type MapStringIntCodec struct{}
 
 func (m MapStringIntCodec) EncodeKey(key string) ([]byte, error) {
@@ -481,6 +1099,20 @@ func (m *rxnHandler) KeyEvent(ctx context.Context, rawEvent []byte) ([]rxn.Keyed
 	return nil, nil
 }
 
+type batchHandler struct {
+	rxnHandler
+	onBatchStartFunc func(ctx context.Context, batch rxn.Batch) error
+	onBatchEndFunc   func(ctx context.Context, batch rxn.Batch) error
+}
+
+func (m *batchHandler) OnBatchStart(ctx context.Context, batch rxn.Batch) error {
+	return m.onBatchStartFunc(ctx, batch)
+}
+
+func (m *batchHandler) OnBatchEnd(ctx context.Context, batch rxn.Batch) error {
+	return m.onBatchEndFunc(ctx, batch)
+}
+
 func setupTestServer(t *testing.T, factory func(*topology.Job, *topology.Operator) rxn.OperatorHandler) (*httptest.Server, handlerpbconnect.HandlerClient) {
 	t.Helper()
 
@@ -11,8 +11,15 @@ type Subject interface {
 	// Key returns the key associated with the current event.
 	Key() []byte
 	// SetTimer sets a timer for the current key. After the timer expires, the
-	// OnTimerExpired method will be called with this timestamp.
+	// OnTimerExpired method will be called with this timestamp. Setting the same
+	// timer more than once has no effect.
 	SetTimer(ts time.Time)
+	// DeleteTimer cancels a timer set for the current key so that
+	// OnTimerExpired won't be called with this timestamp.
+	DeleteTimer(ts time.Time)
 	// Watermark returns the current watermark
 	Watermark() time.Time
+	// ProcessingTime returns the wall clock time when the current batch of
+	// events started processing.
+	ProcessingTime() time.Time
 }
@@ -8,9 +8,11 @@ package rxnsvr
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net"
 	"net/http"
+	"sync"
 
 	"connectrpc.com/connect"
 	"reduction.dev/reduction-go/internal"
@@ -19,9 +21,14 @@ import (
 )
 
 type Server struct {
+	handler    *internal.SynthesizedHandler
 	httpServer *http.Server
 	addr       string
 	listener   net.Listener
+
+	mu      sync.Mutex
+	opened  bool // whether the handler is open
+	stopped bool
 }
 
 type Option func(*Server)
@@ -49,25 +56,33 @@ func New(handler *internal.SynthesizedHandler, opts ...Option) *Server {
 	})
 
 	s := &http.Server{Handler: mux}
-	server := &Server{httpServer: s}
+	server := &Server{handler: handler, httpServer: s}
 	for _, o := range opts {
 		o(server)
 	}
 	return server
 }
 
+// Start opens the handler and serves requests until the server is stopped.
 func (s *Server) Start() error {
+	if err := s.open(); err != nil {
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+
 	if s.listener == nil {
 		var err error
 		s.listener, err = net.Listen("tcp", s.addr)
 		if err != nil {
-			return err
+			return errors.Join(err, s.closeHandler(context.Background()))
 		}
 	}
 
 	slog.Info("starting server", "addr", s.listener.Addr().String())
 	if err := s.httpServer.Serve(s.listener); err != http.ErrServerClosed {
-		return err
+		return errors.Join(err, s.closeHandler(context.Background()))
 	}
 	return nil
 }
@@ -76,8 +91,44 @@ func (s *Server) Addr() string {
 	return s.listener.Addr().String()
 }
 
+// Stop waits for in-flight requests to finish and then closes the handler if
+// Start opened it. If ctx ends before the requests finish, Stop returns the
+// context's error and leaves the handler open, since closing it would fail the
+// requests still using it. Call Stop again to keep waiting.
 func (s *Server) Stop(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return err
+	}
+	return s.closeHandler(ctx)
+}
+
+// open opens the handler unless the server was already stopped.
+func (s *Server) open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return http.ErrServerClosed
+	}
+	if err := s.handler.Open(context.Background()); err != nil {
+		return err
+	}
+	s.opened = true
+	return nil
+}
+
+// closeHandler closes the handler once if it's open.
+func (s *Server) closeHandler(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.opened {
+		return nil
+	}
+	s.opened = false
+	return s.handler.Close(ctx)
 }
 
 func newLoggingInterceptor(prefix string) connect.UnaryInterceptorFunc {
@@ -0,0 +1,141 @@
+package rxnsvr_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/rxnsvr"
+	"reduction.dev/reduction-protocol/handlerpb"
+	"reduction.dev/reduction-protocol/handlerpb/handlerpbconnect"
+)
+
+func TestServer_OpensAndClosesHandler(t *testing.T) {
+	lifecycle := &lifecycleRecorder{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	svr := rxnsvr.New(&internal.SynthesizedHandler{Lifecycle: lifecycle}, rxnsvr.WithListener(listener))
+
+	started := make(chan error, 1)
+	go func() { started <- svr.Start() }()
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + svr.Addr() + "/health")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"open"}, lifecycle.Calls())
+
+	require.NoError(t, svr.Stop(context.Background()))
+	require.NoError(t, <-started)
+	assert.Equal(t, []string{"open", "close"}, lifecycle.Calls())
+}
+
+func TestServer_StopBeforeStartDoesNotCloseHandler(t *testing.T) {
+	lifecycle := &lifecycleRecorder{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	svr := rxnsvr.New(&internal.SynthesizedHandler{Lifecycle: lifecycle}, rxnsvr.WithListener(listener))
+
+	require.NoError(t, svr.Stop(context.Background()))
+	require.NoError(t, svr.Start(), "starting a stopped server returns immediately")
+	assert.Empty(t, lifecycle.Calls())
+}
+
+func TestServer_ClosesHandlerWhenServingFails(t *testing.T) {
+	lifecycle := &lifecycleRecorder{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	svr := rxnsvr.New(&internal.SynthesizedHandler{Lifecycle: lifecycle}, rxnsvr.WithListener(listener))
+
+	assert.Error(t, svr.Start())
+	assert.Equal(t, []string{"open", "close"}, lifecycle.Calls())
+
+	require.NoError(t, svr.Stop(context.Background()))
+	assert.Equal(t, []string{"open", "close"}, lifecycle.Calls(), "the handler is only closed once")
+}
+
+func TestServer_StopTimeoutLeavesHandlerOpenForRunningRequests(t *testing.T) {
+	lifecycle := &lifecycleRecorder{}
+	handler := &blockingHandler{started: make(chan struct{}), release: make(chan struct{})}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	svr := rxnsvr.New(&internal.SynthesizedHandler{OperatorHandler: handler, Lifecycle: lifecycle}, rxnsvr.WithListener(listener))
+
+	started := make(chan error, 1)
+	go func() { started <- svr.Start() }()
+	processed := make(chan error, 1)
+	go func() {
+		client := handlerpbconnect.NewHandlerClient(http.DefaultClient, "http://"+svr.Addr())
+		_, err := client.ProcessEventBatch(context.Background(), connect.NewRequest(&handlerpb.ProcessEventBatchRequest{
+			Events: []*handlerpb.Event{{
+				Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{Key: []byte("key")}},
+			}},
+		}))
+		processed <- err
+	}()
+	<-handler.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, svr.Stop(ctx), context.DeadlineExceeded)
+	assert.Equal(t, []string{"open"}, lifecycle.Calls(), "the handler stays open while a request is running")
+
+	close(handler.release)
+	require.NoError(t, <-processed)
+	require.NoError(t, svr.Stop(context.Background()))
+	require.NoError(t, <-started)
+	assert.Equal(t, []string{"open", "close"}, lifecycle.Calls())
+}
+
+// blockingHandler blocks OnEvent until it's released.
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHandler) OnEvent(ctx context.Context, subject *internal.Subject, event internal.KeyedEvent) error {
+	close(h.started)
+	<-h.release
+	return nil
+}
+
+func (h *blockingHandler) OnTimerExpired(ctx context.Context, subject *internal.Subject, timer time.Time) error {
+	return nil
+}
+
+// lifecycleRecorder records calls to its lifecycle hooks.
+type lifecycleRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *lifecycleRecorder) Open(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, "open")
+	return nil
+}
+
+func (r *lifecycleRecorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, "close")
+	return nil
+}
+
+func (r *lifecycleRecorder) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
@@ -0,0 +1,58 @@
+// The rxntest package provides helpers for testing Reduction jobs.
+package rxntest
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"reduction.dev/reduction-go/topology"
+)
+
+var update = flag.Bool("rxn.update", false, "update golden files instead of comparing with them")
+
+// AssertGolden compares the transcript of a test run, which must have been run
+// with [topology.TestRun.RunLocal], with the golden file at path. The
+// transcript records every batch with its events, expired timers, state
+// mutations, new timers, and sink requests.
+//
+// Run tests with the -rxn.update flag to write the transcripts to their golden
+// files instead:
+//
+//	go test ./path/to/package -rxn.update
+func AssertGolden(t testing.TB, tr *topology.TestRun, path string) {
+	t.Helper()
+	got := tr.Transcript()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create golden file directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file, run with -rxn.update to create it: %v", err)
+	}
+	if string(want) == got {
+		return
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(want)),
+		B:        difflib.SplitLines(got),
+		FromFile: path,
+		ToFile:   "transcript",
+		Context:  3,
+	})
+	if err != nil {
+		t.Fatalf("failed to diff transcript with golden file: %v", err)
+	}
+	t.Errorf("transcript doesn't match golden file, run with -rxn.update to update it:\n%s", diff)
+}
@@ -0,0 +1,99 @@
+package rxntest_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reduction.dev/reduction-go/connectors/embedded"
+	"reduction.dev/reduction-go/connectors/stdio"
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/rxn"
+	"reduction.dev/reduction-go/rxntest"
+	"reduction.dev/reduction-go/topology"
+)
+
+func TestAssertGolden(t *testing.T) {
+	tr := newCountTestRun(t)
+	rxntest.AssertGolden(t, tr, "testdata/count.golden")
+}
+
+func TestAssertGolden_ReportsDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "count.golden")
+	require.NoError(t, os.WriteFile(path, []byte("batch 1\n"), 0o644))
+
+	recorder := &errorRecorder{TB: t}
+	rxntest.AssertGolden(recorder, newCountTestRun(t), path)
+
+	require.Len(t, recorder.errors, 1)
+	assert.Contains(t, recorder.errors[0], "-batch 1\n")
+	assert.Contains(t, recorder.errors[0], "+batch 1 (watermark")
+}
+
+// newCountTestRun runs a job that counts events per key and writes the count
+// to a sink when the watermark passes the end of each minute.
+func newCountTestRun(t *testing.T) *topology.TestRun {
+	job := &topology.Job{}
+	sink := stdio.NewSink(job, "counts")
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{
+		KeyEvent: func(ctx context.Context, record []byte) ([]internal.KeyedEvent, error) {
+			var key string
+			var seconds int64
+			if _, err := fmt.Sscanf(string(record), "%s %d", &key, &seconds); err != nil {
+				return nil, err
+			}
+			return []internal.KeyedEvent{{Key: []byte(key), Timestamp: time.Unix(seconds, 0)}}, nil
+		},
+	})
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			return &countHandler{
+				count: topology.NewValueSpec(op, "count", rxn.ScalarValueCodec[int]{}),
+				sink:  sink,
+			}
+		},
+	})
+	source.Connect(operator)
+	operator.Connect(sink)
+
+	tr := job.NewTestRun()
+	tr.AddRecord([]byte("a 10"))
+	tr.AddRecord([]byte("b 20"))
+	tr.AddRecord([]byte("a 30"))
+	tr.AddWatermarkAt(time.Unix(60, 0))
+	require.NoError(t, tr.RunLocal())
+	return tr
+}
+
+type countHandler struct {
+	count rxn.ValueSpec[int]
+	sink  rxn.Sink[stdio.Event]
+}
+
+func (h *countHandler) OnEvent(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+	state := h.count.StateFor(subject)
+	state.Set(state.Value() + 1)
+	subject.SetTimer(event.Timestamp.Truncate(time.Minute).Add(time.Minute))
+	return nil
+}
+
+func (h *countHandler) OnTimerExpired(ctx context.Context, subject rxn.Subject, timer time.Time) error {
+	state := h.count.StateFor(subject)
+	h.sink.Collect(ctx, stdio.Event(fmt.Sprintf("%s: %d", subject.Key(), state.Value())))
+	state.Drop()
+	return nil
+}
+
+type errorRecorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,194 @@
+package rxntest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/internal/localrun"
+	"reduction.dev/reduction-go/topology"
+)
+
+// ReplayParams configures [AssertReplayEquivalent].
+type ReplayParams struct {
+	// NewJob creates a new job for each replay. The optional output function
+	// returns values to compare between replays in addition to state and sink
+	// requests, such as the values collected by a memory sink.
+	NewJob func() (job *topology.Job, output func() any)
+	// Records to replay, in source order.
+	Records [][]byte
+	// The watermark to advance to after sending all records. Defaults to the
+	// latest event time.
+	Watermark time.Time
+	// The number of randomized replays. Defaults to 100.
+	Replays int
+	// The seed of the first replay. Later replays use the following seeds.
+	Seed uint64
+	// Also shuffle the events of each key instead of keeping them in source
+	// order.
+	ReorderKeyEvents bool
+}
+
+// AssertReplayEquivalent checks that a job's final state and sink output don't
+// depend on how its records are delivered. It first replays the records in
+// source order in a single batch and then replays them once per seed with:
+//
+//   - events of different keys interleaved randomly,
+//   - batches split at random points, and
+//   - expired timers of different keys fired in a random order.
+//
+// When a replay differs from the in-order run, AssertReplayEquivalent reports
+// the smallest failing seed with a diff. Set Seed to that value and Replays to
+// 1 to reproduce the failure.
+func AssertReplayEquivalent(t testing.TB, params ReplayParams) {
+	t.Helper()
+	if params.Replays == 0 {
+		params.Replays = 100
+	}
+
+	want, err := replay(params, nil)
+	if err != nil {
+		t.Fatalf("in-order run failed: %v", err)
+	}
+
+	for seed := params.Seed; seed < params.Seed+uint64(params.Replays); seed++ {
+		got, err := replay(params, rand.New(rand.NewPCG(seed, seed)))
+		if err != nil {
+			t.Fatalf("replay with seed %d failed: %v", seed, err)
+		}
+		if got.equal(want) {
+			continue
+		}
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(want.String()),
+			B:        difflib.SplitLines(got.String()),
+			FromFile: "in-order",
+			ToFile:   fmt.Sprintf("seed %d", seed),
+			Context:  3,
+		})
+		if err != nil {
+			t.Fatalf("failed to diff replay results: %v", err)
+		}
+		t.Errorf("replay with seed %d doesn't match the in-order run:\n%s", seed, diff)
+		return
+	}
+}
+
+// replay runs the records through a new job. Without rng, it sends events in
+// source order in a single batch and fires timers in time and key order.
+func replay(params ReplayParams, rng *rand.Rand) (result replayResult, err error) {
+	job, output := params.NewJob()
+	synthesis, err := job.Synthesize()
+	if err != nil {
+		return replayResult{}, err
+	}
+	handler := synthesis.Handler
+
+	ctx := context.Background()
+	if err := handler.Open(ctx); err != nil {
+		return replayResult{}, err
+	}
+	defer func() {
+		err = errors.Join(err, handler.Close(ctx))
+	}()
+
+	var events []internal.KeyedEvent
+	for _, record := range params.Records {
+		keyed, err := handler.KeyEvent(ctx, record)
+		if err != nil {
+			return replayResult{}, err
+		}
+		events = append(events, keyed...)
+	}
+
+	runner := localrun.New(handler)
+	var flushChance float64
+	if rng != nil {
+		runner.ShuffleTimers(rng)
+		if params.ReorderKeyEvents {
+			rng.Shuffle(len(events), func(i, j int) { events[i], events[j] = events[j], events[i] })
+		} else {
+			events = localrun.InterleaveKeys(rng, events, func(event internal.KeyedEvent) []byte {
+				return event.Key
+			})
+		}
+		flushChance = rng.Float64()
+	}
+
+	for _, event := range events {
+		runner.AddEvent(event)
+		if rng != nil && rng.Float64() < flushChance {
+			if err := runner.Flush(ctx); err != nil {
+				return replayResult{}, err
+			}
+		}
+	}
+	if params.Watermark.IsZero() {
+		err = runner.AdvanceWatermark(ctx)
+	} else {
+		err = runner.AdvanceWatermarkTo(ctx, params.Watermark)
+	}
+	if err != nil {
+		return replayResult{}, err
+	}
+
+	snapshot, err := runner.Snapshot(ctx)
+	if err != nil {
+		return replayResult{}, err
+	}
+	result = replayResult{state: snapshot.State, sinkValues: snapshot.SinkValues}
+	for _, values := range result.sinkValues {
+		slices.SortFunc(values, bytes.Compare)
+	}
+	if output != nil {
+		result.output = output()
+	}
+	return result, nil
+}
+
+// replayResult is the final state and output of a replay. Sink values are
+// sorted because their order depends on the order of events.
+type replayResult struct {
+	state      map[string]map[string]map[string][]byte
+	sinkValues map[string][][]byte
+	output     any
+}
+
+func (r replayResult) equal(other replayResult) bool {
+	return reflect.DeepEqual(r.state, other.state) &&
+		reflect.DeepEqual(r.sinkValues, other.sinkValues) &&
+		reflect.DeepEqual(r.output, other.output)
+}
+
+// String formats the result with one line per state entry and sink value.
+func (r replayResult) String() string {
+	var b strings.Builder
+	for _, key := range slices.Sorted(maps.Keys(r.state)) {
+		for _, namespace := range slices.Sorted(maps.Keys(r.state[key])) {
+			entries := r.state[key][namespace]
+			for _, entryKey := range slices.Sorted(maps.Keys(entries)) {
+				fmt.Fprintf(&b, "state %q %s %q: %q\n", key, namespace, entryKey, entries[entryKey])
+			}
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(r.sinkValues)) {
+		for _, value := range r.sinkValues[id] {
+			fmt.Fprintf(&b, "sink %s: %q\n", id, value)
+		}
+	}
+	if r.output != nil {
+		fmt.Fprintf(&b, "output: %v\n", r.output)
+	}
+	return b.String()
+}
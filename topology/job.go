@@ -2,13 +2,21 @@
 package topology
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"google.golang.org/protobuf/encoding/protojson"
 	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/rxn"
 	"reduction.dev/reduction-go/rxnsvr"
 	"reduction.dev/reduction-protocol/jobconfigpb"
 )
@@ -18,6 +26,19 @@ type Job struct {
 	KeyGroupCount            int
 	WorkingStorageLocation   ResolvableString
 	SavepointStorageLocation ResolvableString
+	// OnDeadLetter receives events that fail in a source's KeyEvent function or
+	// an operator's OnEvent method so that the rest of the batch can proceed.
+	// Collect the dead letter with a sink to keep it. Without OnDeadLetter,
+	// these errors fail the batch and the engine retries it. Errors marked with
+	// [rxn.RetryableError] always fail the batch.
+	//
+	// A failed OnEvent call's state changes, timers, and sink values are
+	// discarded. Records that fail in KeyEvent have no key, so they are all
+	// handled on a single reserved key and OnDeadLetter's subject has no state
+	// of the original record's key. Their dead letters have the latest
+	// timestamp of the records keyed in the same batch, or the zero time when
+	// none were, so that failed records don't advance the watermark.
+	OnDeadLetter func(ctx context.Context, subject rxn.Subject, letter rxn.DeadLetter)
 
 	sources []internal.Source
 	sinks   []internal.SinkSynthesizer
@@ -45,8 +66,12 @@ func (j *Job) Synthesize() (*jobSynthesis, error) {
 		return nil, fmt.Errorf("job is missing source")
 	}
 	if len(j.sources) > 1 {
+		ids := make([]string, len(j.sources))
+		for i, source := range j.sources {
+			ids[i] = source.Synthesize().Config.Id
+		}
 		//lint:ignore ST1005 // capitalizing proper name
-		return nil, fmt.Errorf("Reduction currently supports only one source per job but has %d configured", len(j.sources))
+		return nil, fmt.Errorf("Reduction currently supports only one source per job but has %d configured: %s", len(j.sources), strings.Join(ids, ", "))
 	}
 
 	// Create protobuf config
@@ -74,14 +99,32 @@ func (j *Job) Synthesize() (*jobSynthesis, error) {
 		return nil, fmt.Errorf("source is missing operator")
 	}
 	if len(sourceSynth.Operators) > 1 {
+		ids := make([]string, len(sourceSynth.Operators))
+		for i, op := range sourceSynth.Operators {
+			ids[i] = op.ID
+		}
 		//lint:ignore ST1005 // capitalizing proper name
-		return nil, fmt.Errorf("Reduction currently supports only one operator per source but has %d configured", len(sourceSynth.Operators))
+		return nil, fmt.Errorf("Reduction currently supports only one operator per source but source %q has %d configured: %s",
+			sourceSynth.Config.Id, len(sourceSynth.Operators), strings.Join(ids, ", "))
+	}
+
+	var deadLetterHandler internal.DeadLetterHandler
+	if j.OnDeadLetter != nil {
+		deadLetterHandler = func(ctx context.Context, subject *internal.Subject, letter internal.DeadLetter) {
+			j.OnDeadLetter(ctx, subject, letter)
+		}
 	}
 
+	operatorSynth := sourceSynth.Operators[0].Synthesize()
 	return &jobSynthesis{
 		Handler: &internal.SynthesizedHandler{
-			KeyEventFunc:    sourceSynth.KeyEventFunc,
-			OperatorHandler: sourceSynth.Operators[0].Synthesize().Handler,
+			KeyEventFunc:      sourceSynth.KeyEventFunc,
+			OperatorHandler:   operatorSynth.Handler,
+			StateExpirers:     operatorSynth.StateExpirers,
+			DeadLetterHandler: deadLetterHandler,
+			KeyWorkers:        operatorSynth.KeyWorkers,
+			BatchHooks:        operatorSynth.BatchHooks,
+			Lifecycle:         operatorSynth.Lifecycle,
 		},
 		Config: protoConfig{config},
 	}, nil
@@ -123,7 +166,7 @@ func (j *Job) Run() {
 			log.Fatalf("failed to listen: %v", err)
 		}
 		svr := rxnsvr.New(synth.Handler, rxnsvr.WithListener(listener))
-		if err := svr.Start(); err != nil {
+		if err := serveUntilSignaled(svr); err != nil {
 			log.Fatalf("server stopped with error: %v", err)
 		}
 	case "config":
@@ -132,3 +175,29 @@ func (j *Job) Run() {
 		log.Fatalf("Unknown command: %s", os.Args[1])
 	}
 }
+
+// shutdownTimeout bounds how long a signaled server waits for in-flight
+// requests and the handler's Close. The handler isn't closed if requests are
+// still running when it ends.
+const shutdownTimeout = 30 * time.Second
+
+// serveUntilSignaled runs the server until it fails or the process receives
+// SIGINT or SIGTERM, then stops the server so that the handler is closed.
+func serveUntilSignaled(svr *rxnsvr.Server) error {
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	served := make(chan error, 1)
+	go func() { served <- svr.Start() }()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("stopping server")
+	stopCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return errors.Join(svr.Stop(stopCtx), <-served)
+}
@@ -2,16 +2,23 @@ package topology_test
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reduction.dev/reduction-go/connectors/embedded"
+	"reduction.dev/reduction-go/connectors/memory"
 	"reduction.dev/reduction-go/connectors/stdio"
 	"reduction.dev/reduction-go/internal"
 	"reduction.dev/reduction-go/rxn"
 	"reduction.dev/reduction-go/topology"
+	"reduction.dev/reduction-protocol/handlerpb"
 	"reduction.dev/reduction-protocol/jobconfigpb"
 )
 
@@ -89,3 +96,351 @@ func TestJobSynthesizeConfig(t *testing.T) {
 
 	assert.EqualExportedValues(t, want, &jobConfig)
 }
+
+func TestJobSynthesize_RejectsMultipleOperatorsPerSource(t *testing.T) {
+	job := &topology.Job{}
+	source := stdio.NewSource(job, "test-source", &stdio.SourceParams{})
+	for _, id := range []string{"enrich", "aggregate"} {
+		source.Connect(topology.NewOperator(job, id, &topology.OperatorParams{
+			Handler: func(op *topology.Operator) rxn.OperatorHandler {
+				return nil
+			},
+		}))
+	}
+
+	_, err := job.Synthesize()
+	assert.ErrorContains(t, err, `source "test-source" has 2 configured: enrich, aggregate`)
+}
+
+func TestJobSynthesize_RejectsMultipleSources(t *testing.T) {
+	job := &topology.Job{}
+	stdio.NewSource(job, "clicks", &stdio.SourceParams{})
+	stdio.NewSource(job, "orders", &stdio.SourceParams{})
+
+	_, err := job.Synthesize()
+	assert.ErrorContains(t, err, "only one source per job but has 2 configured: clicks, orders")
+}
+
+func TestJobSynthesize_DeadLettersFailedEvents(t *testing.T) {
+	job := &topology.Job{}
+	deadLetters := memory.NewSink[rxn.DeadLetter](job, "dead-letters")
+	job.OnDeadLetter = func(ctx context.Context, subject rxn.Subject, letter rxn.DeadLetter) {
+		deadLetters.Collect(ctx, letter)
+	}
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{
+		KeyEvent: func(ctx context.Context, record []byte) ([]internal.KeyedEvent, error) {
+			if string(record) == "poison" {
+				return nil, fmt.Errorf("invalid record")
+			}
+			timestamp := time.Unix(10, 0).UTC()
+			if string(record) == "fail" {
+				timestamp = time.Unix(20, 0).UTC()
+			}
+			return []internal.KeyedEvent{{Key: record, Value: record, Timestamp: timestamp}}, nil
+		},
+	})
+	var processed []string
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			return onEventHandler(func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				if string(event.Value) == "fail" {
+					return fmt.Errorf("handler failed")
+				}
+				processed = append(processed, string(event.Value))
+				return nil
+			})
+		},
+	})
+	source.Connect(operator)
+	synth, err := job.Synthesize()
+	require.NoError(t, err)
+	synth.Handler.Now = func() time.Time { return time.Unix(500, 0).UTC() }
+
+	keyResp, err := synth.Handler.KeyEventBatch(context.Background(), &handlerpb.KeyEventBatchRequest{
+		Values: [][]byte{[]byte("poison"), []byte("fail"), []byte("ok")},
+	})
+	require.NoError(t, err, "KeyEvent errors should be dead lettered")
+	assert.Equal(t, time.Unix(20, 0).UTC(), keyResp.Results[0].Events[0].Timestamp.AsTime(),
+		"a failed record should take the batch's latest event time rather than the processing time")
+
+	var events []*handlerpb.Event
+	for _, result := range keyResp.Results {
+		for _, event := range result.Events {
+			events = append(events, &handlerpb.Event{Event: &handlerpb.Event_KeyedEvent{KeyedEvent: event}})
+		}
+	}
+	_, err = synth.Handler.ProcessEventBatch(context.Background(), &handlerpb.ProcessEventBatchRequest{Events: events})
+	require.NoError(t, err, "OnEvent errors should be dead lettered")
+
+	assert.Equal(t, []string{"ok"}, processed, "events after the failures should be processed")
+	assert.Equal(t, []rxn.DeadLetter{{
+		Record:    []byte("poison"),
+		Timestamp: time.Unix(20, 0).UTC(),
+		Error:     "invalid record",
+	}, {
+		Record:    []byte("fail"),
+		Key:       []byte("fail"),
+		Timestamp: time.Unix(20, 0).UTC(),
+		Error:     "handler failed",
+	}}, deadLetters.Records)
+
+	keyResp, err = synth.Handler.KeyEventBatch(context.Background(), &handlerpb.KeyEventBatchRequest{
+		Values: [][]byte{[]byte("poison")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, time.Time{}, keyResp.Results[0].Events[0].Timestamp.AsTime(),
+		"a batch without keyed records should give failed records the zero time")
+}
+
+func TestJobSynthesize_DeadLettersRollBackFailedEvents(t *testing.T) {
+	job := &topology.Job{}
+	job.OnDeadLetter = func(ctx context.Context, subject rxn.Subject, letter rxn.DeadLetter) {}
+	sink := stdio.NewSink(job, "sink")
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{})
+	var count rxn.ValueSpec[int]
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			count = topology.NewValueSpec(op, "count", rxn.ScalarValueCodec[int]{})
+			failures := topology.NewValueSpec(op, "failures", rxn.ScalarValueCodec[int]{})
+			return onEventHandler(func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				state := count.StateFor(subject)
+				state.Set(state.Value() + 1)
+				subject.SetTimer(event.Timestamp.Add(time.Minute))
+				sink.Collect(ctx, stdio.Event(event.Value))
+				if string(event.Value) == "fail" {
+					failures.StateFor(subject).Set(1)
+					return fmt.Errorf("handler failed")
+				}
+				return nil
+			})
+		},
+	})
+	source.Connect(operator)
+	operator.Connect(sink)
+
+	var keyEvents []*handlerpb.Event
+	for i, value := range []string{"ok", "fail", "ok"} {
+		keyEvents = append(keyEvents, &handlerpb.Event{Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{
+			Key:       []byte("key"),
+			Value:     []byte(value),
+			Timestamp: timestamppb.New(time.Unix(int64(i), 0)),
+		}}})
+	}
+	synth, err := job.Synthesize()
+	require.NoError(t, err)
+	resp, err := synth.Handler.ProcessEventBatch(context.Background(), &handlerpb.ProcessEventBatchRequest{Events: keyEvents})
+	require.NoError(t, err)
+
+	require.Len(t, resp.KeyResults, 1)
+	assert.Equal(t, []*timestamppb.Timestamp{
+		timestamppb.New(time.Unix(60, 0)),
+		timestamppb.New(time.Unix(62, 0)),
+	}, resp.KeyResults[0].NewTimers, "the failed event's timer is discarded")
+	assert.Len(t, resp.SinkRequests, 2, "the failed event's sink value is discarded")
+	subject := internal.NewSubject([]byte("key"), stateEntriesFromKeyResult(resp.KeyResults[0]), time.Time{}, time.Time{}, time.Time{})
+	assert.Equal(t, 2, count.StateFor(subject).Value(), "the failed event's state change is discarded")
+	for _, ns := range resp.KeyResults[0].StateMutationNamespaces {
+		assert.NotEqual(t, "failures", ns.Namespace, "state first used by the failed event is discarded")
+	}
+}
+
+// stateEntriesFromKeyResult converts a key result's put mutations to the state
+// entries of a subject.
+func stateEntriesFromKeyResult(result *handlerpb.KeyResult) map[string][]internal.StateEntry {
+	entries := make(map[string][]internal.StateEntry)
+	for _, ns := range result.StateMutationNamespaces {
+		for _, m := range ns.Mutations {
+			if put := m.GetPut(); put != nil {
+				entries[ns.Namespace] = append(entries[ns.Namespace], internal.StateEntry{Key: put.Key, Value: put.Value})
+			}
+		}
+	}
+	return entries
+}
+
+func TestJobSynthesize_DeadLettersSkipRetryableErrors(t *testing.T) {
+	job := &topology.Job{}
+	deadLetters := memory.NewSink[rxn.DeadLetter](job, "dead-letters")
+	job.OnDeadLetter = func(ctx context.Context, subject rxn.Subject, letter rxn.DeadLetter) {
+		deadLetters.Collect(ctx, letter)
+	}
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{})
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			return onEventHandler(func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				if string(event.Value) == "timeout" {
+					return rxn.RetryableError(fmt.Errorf("timeout"))
+				}
+				return rxn.BadInputError(fmt.Errorf("bad value"))
+			})
+		},
+	})
+	source.Connect(operator)
+	synth, err := job.Synthesize()
+	require.NoError(t, err)
+
+	process := func(value string) error {
+		_, err := synth.Handler.ProcessEventBatch(context.Background(), &handlerpb.ProcessEventBatchRequest{
+			Events: []*handlerpb.Event{{Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{
+				Key:       []byte("key"),
+				Value:     []byte(value),
+				Timestamp: timestamppb.New(time.Unix(10, 0)),
+			}}}},
+		})
+		return err
+	}
+
+	err = process("timeout")
+	assert.Equal(t, internal.ErrorKindRetryable, internal.ErrorKindOf(err), "retryable errors fail the batch")
+	assert.Empty(t, deadLetters.Records)
+
+	require.NoError(t, process("bad"))
+	require.Len(t, deadLetters.Records, 1)
+	assert.Equal(t, "bad value", deadLetters.Records[0].Error, "dead letters have the error message without a status")
+}
+
+type onEventHandler func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error
+
+func (h onEventHandler) OnEvent(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+	return h(ctx, subject, event)
+}
+
+func (h onEventHandler) OnTimerExpired(ctx context.Context, subject rxn.Subject, timer time.Time) error {
+	return nil
+}
+
+func TestJobSynthesize_KeyWorkersMatchSequentialProcessing(t *testing.T) {
+	var events []*handlerpb.Event
+	for i := range 100 {
+		events = append(events, &handlerpb.Event{Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{
+			Key:       []byte(fmt.Sprintf("key-%d", i%7)),
+			Value:     []byte(fmt.Sprintf("%d", i)),
+			Timestamp: timestamppb.New(time.Unix(int64(i), 0)),
+		}}})
+	}
+
+	process := func(keyWorkers int) (*handlerpb.ProcessEventBatchResponse, map[string][]string) {
+		job := &topology.Job{}
+		source := embedded.NewSource(job, "source", &embedded.SourceParams{})
+		var mu sync.Mutex
+		seen := make(map[string][]string)
+		operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+			KeyWorkers: keyWorkers,
+			Handler: func(op *topology.Operator) rxn.OperatorHandler {
+				lastValue := topology.NewValueSpec(op, "last", rxn.ScalarValueCodec[string]{})
+				return onEventHandler(func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+					lastValue.StateFor(subject).Set(string(event.Value))
+					subject.SetTimer(event.Timestamp.Add(time.Minute))
+					mu.Lock()
+					defer mu.Unlock()
+					seen[string(event.Key)] = append(seen[string(event.Key)], string(event.Value))
+					return nil
+				})
+			},
+		})
+		source.Connect(operator)
+		synth, err := job.Synthesize()
+		require.NoError(t, err)
+
+		resp, err := synth.Handler.ProcessEventBatch(context.Background(), &handlerpb.ProcessEventBatchRequest{Events: events})
+		require.NoError(t, err)
+		return resp, seen
+	}
+
+	sequentialResp, sequentialSeen := process(0)
+	concurrentResp, concurrentSeen := process(4)
+
+	assert.Equal(t, sequentialSeen, concurrentSeen, "each key's events should be processed in order")
+	assert.True(t, proto.Equal(sequentialResp, concurrentResp), "responses should be identical")
+}
+
+func TestJobSynthesize_KeyWorkersReportHandlerFailures(t *testing.T) {
+	process := func(failingKey string) error {
+		job := &topology.Job{}
+		source := embedded.NewSource(job, "source", &embedded.SourceParams{})
+		operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+			KeyWorkers: 4,
+			Handler: func(op *topology.Operator) rxn.OperatorHandler {
+				return onEventHandler(func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+					switch string(event.Key) {
+					case "panic":
+						panic("boom")
+					case "error":
+						return fmt.Errorf("handler failed")
+					}
+					return nil
+				})
+			},
+		})
+		source.Connect(operator)
+		synth, err := job.Synthesize()
+		require.NoError(t, err)
+
+		var events []*handlerpb.Event
+		for i := range 8 {
+			key := fmt.Sprintf("key-%d", i)
+			if i == 5 {
+				key = failingKey
+			}
+			events = append(events, &handlerpb.Event{Event: &handlerpb.Event_KeyedEvent{KeyedEvent: &handlerpb.KeyedEvent{
+				Key:       []byte(key),
+				Timestamp: timestamppb.New(time.Unix(int64(i), 0)),
+			}}})
+		}
+		_, err = synth.Handler.ProcessEventBatch(context.Background(), &handlerpb.ProcessEventBatchRequest{Events: events})
+		return err
+	}
+
+	t.Run("panic", func(t *testing.T) {
+		err := process("panic")
+		var panicErr *internal.PanicError
+		require.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, "boom", panicErr.Value)
+		assert.NotEmpty(t, panicErr.Stack)
+		assert.Equal(t, internal.ErrorKindUser, internal.ErrorKindOf(err))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		err := process("error")
+		assert.ErrorContains(t, err, "handler failed")
+		assert.Equal(t, internal.ErrorKindUser, internal.ErrorKindOf(err))
+	})
+}
+
+func TestJobSynthesize_LifecycleHooks(t *testing.T) {
+	job := &topology.Job{}
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{})
+	handler := &lifecycleHandler{}
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			return handler
+		},
+	})
+	source.Connect(operator)
+	synth, err := job.Synthesize()
+	require.NoError(t, err)
+
+	require.NoError(t, synth.Handler.Open(context.Background()))
+	assert.Equal(t, []string{"Open"}, handler.calls)
+
+	handler.closeErr = fmt.Errorf("connection already closed")
+	err = synth.Handler.Close(context.Background())
+	assert.EqualError(t, err, "failed to close handler: connection already closed")
+	assert.Equal(t, []string{"Open", "Close"}, handler.calls)
+}
+
+type lifecycleHandler struct {
+	onEventHandler
+	calls    []string
+	closeErr error
+}
+
+func (h *lifecycleHandler) Open(ctx context.Context) error {
+	h.calls = append(h.calls, "Open")
+	return nil
+}
+
+func (h *lifecycleHandler) Close(ctx context.Context) error {
+	h.calls = append(h.calls, "Close")
+	return h.closeErr
+}
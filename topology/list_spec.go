@@ -0,0 +1,38 @@
+package topology
+
+import (
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/internal/states"
+	"reduction.dev/reduction-go/rxn"
+)
+
+// NewListSpec creates a [ListSpec], registering itself with the provided
+// [topology.Operator]. Each list item is stored as a separate entry keyed by
+// its position so that appending doesn't rewrite the existing items.
+func NewListSpec[T any](op *Operator, id string, codec rxn.ValueCodec[T]) rxn.ListSpec[T] {
+	ss := states.StateSpec[states.ListState[T]]{
+		ID:    id,
+		Query: internal.QueryTypeScan,
+		Load: func(stateEntries []internal.StateEntry) (*states.ListState[T], error) {
+			internalState := states.NewListState(id, codec)
+			err := internalState.Load(stateEntries)
+			if err != nil {
+				return nil, err
+			}
+			return internalState, nil
+		},
+		Mutations: func(state *states.ListState[T]) ([]internal.StateMutation, error) {
+			return state.Mutations()
+		},
+	}
+	op.RegisterSpec(ss.ID, ss.Query)
+	return &listSpec[T]{ss}
+}
+
+type listSpec[T any] struct {
+	spec states.StateSpec[states.ListState[T]]
+}
+
+func (l *listSpec[T]) StateFor(subject rxn.Subject) rxn.ListState[T] {
+	return l.spec.StateFor(internal.CastToSubject(subject))
+}
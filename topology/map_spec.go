@@ -9,8 +9,9 @@ import (
 // NewMapSpec creates a [MapSpec], registering itself with the provided
 // [topology.Operator]. The ID with the subject's key uniquely identifies the state
 // for a key to DKV queries. The codec defines how data is parsed and serialized
-// for network transport and storage.
-func NewMapSpec[K comparable, T any](op *Operator, id string, codec states.MapCodec[K, T]) rxn.MapSpec[K, T] {
+// for network transport and storage. Options such as [WithTTL] configure
+// optional behavior.
+func NewMapSpec[K comparable, T any](op *Operator, id string, codec states.MapCodec[K, T], opts ...StateOption) rxn.MapSpec[K, T] {
 	ss := states.StateSpec[states.MapState[K, T]]{
 		ID:    id,
 		Query: internal.QueryTypeScan,
@@ -26,7 +27,7 @@ func NewMapSpec[K comparable, T any](op *Operator, id string, codec states.MapCo
 			return state.Mutations()
 		},
 	}
-	op.RegisterSpec(ss.ID, ss.Query)
+	registerStateSpec(op, &ss, opts)
 	return &mapSpec[K, T]{ss}
 }
 
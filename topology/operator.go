@@ -13,13 +13,26 @@ type Operator = internal.Operator
 type OperatorParams struct {
 	Parallelism int
 	Handler     HandlerFactory
+	// KeyWorkers opts in to processing up to this many keys concurrently
+	// within a batch. Each key's events are still processed in order. The
+	// handler, and the job's OnDeadLetter function, must be safe to call
+	// concurrently for different keys.
+	KeyWorkers int
 }
 
 type HandlerFactory = func(op *Operator) rxn.OperatorHandler
 
 func NewOperator(job *Job, id string, params *OperatorParams) *Operator {
 	operator := internal.NewOperator(id)
-	operator.Handler = internalSubjectHandler{params.Handler(operator)}
+	operator.KeyWorkers = params.KeyWorkers
+	handler := params.Handler(operator)
+	operator.Handler = internalSubjectHandler{handler}
+	if batchHandler, ok := handler.(rxn.BatchHandler); ok {
+		operator.BatchHooks = batchHandler
+	}
+	if lifecycleHandler, ok := handler.(rxn.LifecycleHandler); ok {
+		operator.Lifecycle = lifecycleHandler
+	}
 
 	return operator
 }
@@ -0,0 +1,58 @@
+package topology
+
+import (
+	"time"
+
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/internal/states"
+)
+
+// StateOption configures optional behavior for a state spec.
+type StateOption func(*stateOptions)
+
+type stateOptions struct {
+	ttl *states.TTL
+}
+
+// TimeDomain selects the clock used to measure time.
+type TimeDomain = internal.TimeDomain
+
+const (
+	// EventTime is measured by the watermark.
+	EventTime = internal.EventTime
+	// ProcessingTime is measured by the handler's wall clock.
+	ProcessingTime = internal.ProcessingTime
+)
+
+// WithTTL expires state entries ttl after they were last written. Expired
+// entries are hidden when reading state and deleted automatically.
+//
+// With [EventTime], an entry expires when the watermark passes the timestamp
+// of the event that last wrote it plus ttl. Expired entries of keys that stop
+// receiving events are deleted by an internal timer that doesn't call the
+// handler's OnTimerExpired.
+//
+// With [ProcessingTime], an entry expires by the handler's wall clock and is
+// deleted the next time the key's state is loaded.
+//
+// TTL changes the storage format so it can't be added to existing state.
+func WithTTL(ttl time.Duration, domain TimeDomain) StateOption {
+	return func(o *stateOptions) {
+		o.ttl = &states.TTL{Duration: ttl, Domain: domain}
+	}
+}
+
+// registerStateSpec registers the spec's query type and, if the spec
+// expires entries, its expirer with the operator.
+func registerStateSpec[T any](op *Operator, ss *states.StateSpec[T], opts []StateOption) {
+	var options stateOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	ss.TTL = options.ttl
+
+	op.RegisterSpec(ss.ID, ss.Query)
+	if ss.TTL != nil {
+		op.RegisterExpirer(ss.Expire)
+	}
+}
@@ -4,25 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"sync"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/internal/localrun"
 	"reduction.dev/reduction-go/internal/rpc"
+	"reduction.dev/reduction-go/rxn"
 	"reduction.dev/reduction-protocol/handlerpb"
 	"reduction.dev/reduction-protocol/testrunpb"
 )
 
 func (j *Job) NewTestRun() *TestRun {
-	tr := &TestRun{
-		commands: make([][]byte, 0),
-		job:      j,
-	}
+	tr := &TestRun{job: j}
 	synthesis, err := j.Synthesize()
 	if err != nil {
 		tr.err = fmt.Errorf("failed to synthesize job: %w", err)
@@ -33,12 +34,41 @@ func (j *Job) NewTestRun() *TestRun {
 	return tr
 }
 
-// A TestRun accumulates commands and runs them against `reduction testrun`.
+// A TestRun accumulates commands and runs them against `reduction testrun` or
+// in the current process with RunLocal.
 type TestRun struct {
-	commands [][]byte
-	job      *Job
-	err      error
-	handler  *internal.SynthesizedHandler
+	commands  []testRunCommand
+	job       *Job
+	err       error
+	handler   *internal.SynthesizedHandler
+	local     *localrun.Runner
+	snapshots []TestRunSnapshot
+}
+
+// TestRunSnapshot is the state and sink output of a local test run recorded by
+// [TestRun.Snapshot]. State maps keys to state IDs to stored entry values by
+// entry key.
+type TestRunSnapshot = localrun.Snapshot
+
+type testRunCommandKind int
+
+const (
+	commandKeyedEvent testRunCommandKind = iota
+	commandWatermark
+	commandWatermarkAt
+	commandProcessingTime
+	commandSnapshot
+	commandSeedState
+)
+
+// A command recorded by a TestRun.
+type testRunCommand struct {
+	kind       testRunCommandKind
+	keyedEvent internal.KeyedEvent
+	time       time.Time
+	duration   time.Duration
+	key        []byte
+	seed       func(subject rxn.Subject)
 }
 
 func (t *TestRun) AddRecord(record []byte) {
@@ -53,42 +83,149 @@ func (t *TestRun) AddRecord(record []byte) {
 	}
 
 	for _, ke := range keyedEvents {
-		cmd := &testrunpb.RunnerCommand{
-			Command: &testrunpb.RunnerCommand_AddKeyedEvent{
-				AddKeyedEvent: &testrunpb.AddKeyedEvent{
-					KeyedEvent: &handlerpb.KeyedEvent{
-						Key:       ke.Key,
-						Timestamp: timestamppb.New(ke.Timestamp),
-						Value:     ke.Value,
-					},
-				},
-			},
+		t.commands = append(t.commands, testRunCommand{kind: commandKeyedEvent, keyedEvent: ke})
+	}
+}
+
+func (t *TestRun) AddWatermark() {
+	if t.err != nil {
+		return
+	}
+	t.commands = append(t.commands, testRunCommand{kind: commandWatermark})
+}
+
+// AddWatermarkAt advances the watermark to the given time, firing the timers
+// that it passes. Only supported by RunLocal.
+func (t *TestRun) AddWatermarkAt(watermark time.Time) {
+	if t.err != nil {
+		return
+	}
+	t.commands = append(t.commands, testRunCommand{kind: commandWatermarkAt, time: watermark})
+}
+
+// AdvanceProcessingTime moves the processing time reported to the handler
+// forward for the following events. Only supported by RunLocal, where
+// processing time starts at the Unix epoch.
+func (t *TestRun) AdvanceProcessingTime(d time.Duration) {
+	if t.err != nil {
+		return
+	}
+	t.commands = append(t.commands, testRunCommand{kind: commandProcessingTime, duration: d})
+}
+
+// Snapshot records the keyed state and the sink values collected since the
+// previous snapshot once the preceding commands are processed. The snapshots
+// are available from Snapshots after the run. Only supported by RunLocal.
+func (t *TestRun) Snapshot() {
+	if t.err != nil {
+		return
+	}
+	t.commands = append(t.commands, testRunCommand{kind: commandSnapshot})
+}
+
+// RunLocal runs the commands in the current process without the Reduction
+// CLI. Events are processed in batches between watermarks. Keyed state is
+// kept between batches and timers fire when a watermark passes them.
+// Watermarks advance to the latest event timestamp added before them. Values
+// that sinks send to the engine, like the stdio sink's, are available from
+// SinkValues while the memory sink records values itself.
+func (t *TestRun) RunLocal() error {
+	if t.err != nil {
+		return t.err
+	}
+
+	ctx := context.Background()
+	if err := t.handler.Open(ctx); err != nil {
+		return err
+	}
+	t.local = localrun.New(t.handler)
+	err := t.runLocalCommands(ctx)
+	return errors.Join(err, t.handler.Close(ctx))
+}
+
+func (t *TestRun) runLocalCommands(ctx context.Context) error {
+	t.snapshots = nil
+	for _, cmd := range t.commands {
+		var err error
+		switch cmd.kind {
+		case commandKeyedEvent:
+			t.local.AddEvent(cmd.keyedEvent)
+		case commandWatermark:
+			err = t.local.AdvanceWatermark(ctx)
+		case commandWatermarkAt:
+			err = t.local.AdvanceWatermarkTo(ctx, cmd.time)
+		case commandProcessingTime:
+			err = t.local.AdvanceProcessingTime(ctx, cmd.duration)
+		case commandSnapshot:
+			var snapshot TestRunSnapshot
+			snapshot, err = t.local.Snapshot(ctx)
+			t.snapshots = append(t.snapshots, snapshot)
+		case commandSeedState:
+			err = t.local.SeedState(ctx, cmd.key, func(subject *internal.Subject) {
+				cmd.seed(subject)
+			})
 		}
-		msgData, err := proto.Marshal(cmd)
 		if err != nil {
-			t.err = fmt.Errorf("failed to marshal command: %w", err)
-			return
+			return err
 		}
-		t.commands = append(t.commands, msgData)
 	}
+	return t.local.Flush(ctx)
 }
 
-func (t *TestRun) AddWatermark() {
+// SeedState stores state for a key as if a handler had written it, for
+// instance to test how a handler continues from restored state. The seed
+// function sets state through state specs with the key's subject:
+//
+//	tr.SeedState([]byte("user-1"), func(subject rxn.Subject) {
+//		countSpec.StateFor(subject).Set(10)
+//	})
+//
+// Timers set by the seed function are stored as well. Only supported by
+// RunLocal.
+func (t *TestRun) SeedState(key []byte, seed func(subject rxn.Subject)) {
 	if t.err != nil {
 		return
 	}
+	t.commands = append(t.commands, testRunCommand{kind: commandSeedState, key: key, seed: seed})
+}
 
-	cmd := &testrunpb.RunnerCommand{
-		Command: &testrunpb.RunnerCommand_AddWatermark{
-			AddWatermark: &testrunpb.AddWatermark{},
-		},
+// Subject returns a subject over a key's state at the end of RunLocal so that
+// tests can read the state through state specs:
+//
+//	count := countSpec.StateFor(tr.Subject([]byte("user-1"))).Value()
+//
+// Changes made with the subject are discarded. Use [TestRunSnapshot.Subject]
+// to read the state at an earlier step.
+func (t *TestRun) Subject(key []byte) rxn.Subject {
+	if t.local == nil {
+		return internal.NewSubject(key, nil, time.Time{}, time.Time{}, time.Time{})
 	}
-	msgData, err := proto.Marshal(cmd)
-	if err != nil {
-		t.err = fmt.Errorf("failed to marshal command: %w", err)
-		return
+	return t.local.Subject(key)
+}
+
+// Transcript returns a stable textual record of each batch that RunLocal sent
+// to the handler with its events, expired timers, state mutations, new timers,
+// and sink requests. See [reduction.dev/reduction-go/rxntest.AssertGolden] to
+// compare it with a golden file.
+func (t *TestRun) Transcript() string {
+	if t.local == nil {
+		return ""
+	}
+	return t.local.Transcript()
+}
+
+// Snapshots returns the snapshots recorded during RunLocal in order.
+func (t *TestRun) Snapshots() []TestRunSnapshot {
+	return t.snapshots
+}
+
+// SinkValues returns the values that the handler collected for a sink during
+// RunLocal.
+func (t *TestRun) SinkValues(sinkID string) [][]byte {
+	if t.local == nil {
+		return nil
 	}
-	t.commands = append(t.commands, msgData)
+	return t.local.SinkValues(sinkID)
 }
 
 func (t *TestRun) Run() error {
@@ -96,6 +233,19 @@ func (t *TestRun) Run() error {
 		return t.err
 	}
 
+	messages := make([][]byte, 0, len(t.commands)+1)
+	for _, cmd := range t.commands {
+		pbCmd, err := cmd.proto()
+		if err != nil {
+			return err
+		}
+		msgData, err := proto.Marshal(pbCmd)
+		if err != nil {
+			return fmt.Errorf("failed to marshal command: %w", err)
+		}
+		messages = append(messages, msgData)
+	}
+
 	// Add Run command
 	cmd := &testrunpb.RunnerCommand{
 		Command: &testrunpb.RunnerCommand_Run{
@@ -106,7 +256,7 @@ func (t *TestRun) Run() error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal run command: %w", err)
 	}
-	t.commands = append(t.commands, msgData)
+	messages = append(messages, msgData)
 
 	trCmd := exec.Command("reduction", "testrun")
 
@@ -139,7 +289,7 @@ func (t *TestRun) Run() error {
 	}()
 
 	// Write commands
-	for _, msg := range t.commands {
+	for _, msg := range messages {
 		if err := binary.Write(stdin, binary.BigEndian, uint32(len(msg))); err != nil {
 			return fmt.Errorf("failed to write message length: %w", err)
 		}
@@ -154,8 +304,12 @@ func (t *TestRun) Run() error {
 		return fmt.Errorf("failed to synthesize job: %w", err)
 	}
 
+	if err := synthesis.Handler.Open(context.Background()); err != nil {
+		return err
+	}
 	pipeHandler := rpc.NewPipeHandler(synthesis.Handler, stdin, stdout)
-	if err := pipeHandler.ProcessMessages(context.Background()); err != nil {
+	processErr := pipeHandler.ProcessMessages(context.Background())
+	if err := errors.Join(processErr, synthesis.Handler.Close(context.Background())); err != nil {
 		return err
 	}
 
@@ -187,3 +341,35 @@ func (e *commandError) Error() string {
 	}
 	return b.String()
 }
+
+func (c testRunCommand) proto() (*testrunpb.RunnerCommand, error) {
+	switch c.kind {
+	case commandKeyedEvent:
+		return &testrunpb.RunnerCommand{
+			Command: &testrunpb.RunnerCommand_AddKeyedEvent{
+				AddKeyedEvent: &testrunpb.AddKeyedEvent{
+					KeyedEvent: &handlerpb.KeyedEvent{
+						Key:       c.keyedEvent.Key,
+						Timestamp: timestamppb.New(c.keyedEvent.Timestamp),
+						Value:     c.keyedEvent.Value,
+					},
+				},
+			},
+		}, nil
+	case commandWatermark:
+		return &testrunpb.RunnerCommand{
+			Command: &testrunpb.RunnerCommand_AddWatermark{
+				AddWatermark: &testrunpb.AddWatermark{},
+			},
+		}, nil
+	case commandWatermarkAt:
+		return nil, fmt.Errorf("TestRun.AddWatermarkAt is only supported by RunLocal")
+	case commandProcessingTime:
+		return nil, fmt.Errorf("TestRun.AdvanceProcessingTime is only supported by RunLocal")
+	case commandSnapshot:
+		return nil, fmt.Errorf("TestRun.Snapshot is only supported by RunLocal")
+	case commandSeedState:
+		return nil, fmt.Errorf("TestRun.SeedState is only supported by RunLocal")
+	}
+	return nil, fmt.Errorf("unknown test run command %d", c.kind)
+}
@@ -0,0 +1,208 @@
+package topology_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reduction.dev/reduction-go/connectors/embedded"
+	"reduction.dev/reduction-go/connectors/memory"
+	"reduction.dev/reduction-go/connectors/stdio"
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/rxn"
+	"reduction.dev/reduction-go/topology"
+)
+
+// countHandler counts events per key and emits the count when a timer fires
+// at the end of each minute.
+type countHandler struct {
+	spec rxn.ValueSpec[int]
+	sink rxn.Sink[string]
+}
+
+func (h *countHandler) OnEvent(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+	state := h.spec.StateFor(subject)
+	state.Set(state.Value() + 1)
+	subject.SetTimer(event.Timestamp.Truncate(time.Minute).Add(time.Minute))
+	return nil
+}
+
+func (h *countHandler) OnTimerExpired(ctx context.Context, subject rxn.Subject, timer time.Time) error {
+	h.sink.Collect(ctx, fmt.Sprintf("%s: %d at %s", subject.Key(), h.spec.StateFor(subject).Value(), timer.Format(time.TimeOnly)))
+	return nil
+}
+
+// newCountJob creates a job whose records are a key and a big-endian unix
+// timestamp in seconds.
+func newCountJob() (*topology.Job, *memory.Sink[string], rxn.ValueSpec[int]) {
+	job := &topology.Job{}
+	sink := memory.NewSink[string](job, "sink")
+	var spec rxn.ValueSpec[int]
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{
+		KeyEvent: func(ctx context.Context, record []byte) ([]internal.KeyedEvent, error) {
+			return []internal.KeyedEvent{{
+				Key:       record[8:],
+				Timestamp: time.Unix(int64(binary.BigEndian.Uint64(record)), 0).UTC(),
+			}}, nil
+		},
+	})
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			spec = topology.NewValueSpec(op, "count", rxn.ScalarValueCodec[int]{})
+			return &countHandler{spec: spec, sink: sink}
+		},
+	})
+	source.Connect(operator)
+	operator.Connect(sink)
+	return job, sink, spec
+}
+
+func countRecord(key string, seconds int) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, uint64(seconds)), key...)
+}
+
+func TestTestRun_RunLocal(t *testing.T) {
+	job, sink, _ := newCountJob()
+
+	tr := job.NewTestRun()
+	tr.AddRecord(countRecord("a", 10))
+	tr.AddRecord(countRecord("b", 20))
+	tr.AddWatermark()
+	tr.AddRecord(countRecord("a", 30))
+	tr.AddRecord(countRecord("a", 70))
+	tr.AddWatermark()
+	require.NoError(t, tr.RunLocal())
+
+	// Events before a watermark are processed before the timers it fires. The
+	// timer for the event at 70s remains pending.
+	assert.Equal(t, []string{
+		"a: 3 at 00:01:00",
+		"b: 1 at 00:01:00",
+	}, sink.Records, "timers should fire once the watermark passes them with state kept between batches")
+}
+
+func TestTestRun_RunLocalSinkValues(t *testing.T) {
+	job := &topology.Job{}
+	sink := stdio.NewSink(job, "sink")
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{
+		KeyEvent: func(ctx context.Context, record []byte) ([]internal.KeyedEvent, error) {
+			return []internal.KeyedEvent{{Key: record, Value: record}}, nil
+		},
+	})
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			return onEventHandler(func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				sink.Collect(ctx, stdio.Event(event.Value))
+				return nil
+			})
+		},
+	})
+	source.Connect(operator)
+	operator.Connect(sink)
+
+	tr := job.NewTestRun()
+	tr.AddRecord([]byte("one"))
+	tr.AddRecord([]byte("two"))
+	require.NoError(t, tr.RunLocal())
+
+	assert.Equal(t, [][]byte{[]byte("one"), []byte("two")}, tr.SinkValues("sink"))
+}
+
+func TestTestRun_AddWatermarkAtFiresTimers(t *testing.T) {
+	job, sink, _ := newCountJob()
+
+	tr := job.NewTestRun()
+	tr.AddRecord(countRecord("a", 10))
+	tr.AddWatermarkAt(time.Unix(59, 0))
+	tr.Snapshot()
+	tr.AddWatermarkAt(time.Unix(60, 0))
+	tr.Snapshot()
+	require.NoError(t, tr.RunLocal())
+
+	snapshots := tr.Snapshots()
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, time.Unix(59, 0).UTC(), snapshots[0].Watermark.UTC())
+	assert.Equal(t, time.Unix(60, 0).UTC(), snapshots[1].Watermark.UTC())
+	assert.Equal(t, []string{"a: 1 at 00:01:00"}, sink.Records, "timer should fire when the watermark reaches it")
+}
+
+func TestTestRun_AdvanceProcessingTime(t *testing.T) {
+	job := &topology.Job{}
+	sink := stdio.NewSink(job, "sink")
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{
+		KeyEvent: func(ctx context.Context, record []byte) ([]internal.KeyedEvent, error) {
+			return []internal.KeyedEvent{{Key: record}}, nil
+		},
+	})
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			return onEventHandler(func(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+				sink.Collect(ctx, stdio.Event(subject.ProcessingTime().UTC().Format(time.TimeOnly)))
+				return nil
+			})
+		},
+	})
+	source.Connect(operator)
+	operator.Connect(sink)
+
+	tr := job.NewTestRun()
+	tr.AddRecord([]byte("a"))
+	tr.Snapshot()
+	tr.AdvanceProcessingTime(5 * time.Minute)
+	tr.AddRecord([]byte("a"))
+	tr.Snapshot()
+	require.NoError(t, tr.RunLocal())
+
+	snapshots := tr.Snapshots()
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, map[string][][]byte{"sink": {[]byte("00:00:00")}}, snapshots[0].SinkValues)
+	assert.Equal(t, map[string][][]byte{"sink": {[]byte("00:05:00")}}, snapshots[1].SinkValues,
+		"snapshots should only include sink values since the previous snapshot")
+}
+
+func TestTestRun_SnapshotState(t *testing.T) {
+	job, _, _ := newCountJob()
+
+	tr := job.NewTestRun()
+	tr.AddRecord(countRecord("a", 10))
+	tr.AddRecord(countRecord("a", 20))
+	tr.Snapshot()
+	require.NoError(t, tr.RunLocal())
+
+	count, err := rxn.ScalarValueCodec[int]{}.Encode(2)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]map[string][]byte{
+		"a": {"count": {"count": count}},
+	}, tr.Snapshots()[0].State)
+}
+
+func TestTestRun_RunRejectsLocalOnlyCommands(t *testing.T) {
+	job, _, _ := newCountJob()
+
+	tr := job.NewTestRun()
+	tr.AddWatermarkAt(time.Unix(60, 0))
+	assert.EqualError(t, tr.Run(), "TestRun.AddWatermarkAt is only supported by RunLocal")
+}
+
+func TestTestRun_SeedAndInspectState(t *testing.T) {
+	job, sink, countSpec := newCountJob()
+
+	tr := job.NewTestRun()
+	tr.SeedState([]byte("a"), func(subject rxn.Subject) {
+		countSpec.StateFor(subject).Set(5)
+		subject.SetTimer(time.Unix(60, 0))
+	})
+	tr.Snapshot()
+	tr.AddRecord(countRecord("a", 10))
+	tr.AddWatermarkAt(time.Unix(60, 0))
+	require.NoError(t, tr.RunLocal())
+
+	assert.Equal(t, 5, countSpec.StateFor(tr.Snapshots()[0].Subject([]byte("a"))).Value(), "snapshot should have the seeded state")
+	assert.Equal(t, 6, countSpec.StateFor(tr.Subject([]byte("a"))).Value(), "handler should continue from the seeded state")
+	assert.Equal(t, 0, countSpec.StateFor(tr.Subject([]byte("b"))).Value(), "unknown keys should have empty state")
+	assert.Equal(t, []string{"a: 6 at 00:01:00"}, sink.Records, "seeded timer should fire")
+}
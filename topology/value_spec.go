@@ -6,7 +6,7 @@ import (
 	"reduction.dev/reduction-go/rxn"
 )
 
-func NewValueSpec[T any](op *Operator, id string, codec rxn.ValueCodec[T]) rxn.ValueSpec[T] {
+func NewValueSpec[T any](op *Operator, id string, codec rxn.ValueCodec[T], opts ...StateOption) rxn.ValueSpec[T] {
 	ss := states.StateSpec[states.ValueState[T]]{
 		ID:    id,
 		Query: internal.QueryTypeGet,
@@ -22,7 +22,7 @@ func NewValueSpec[T any](op *Operator, id string, codec rxn.ValueCodec[T]) rxn.V
 			return state.Mutations()
 		},
 	}
-	op.RegisterSpec(ss.ID, ss.Query)
+	registerStateSpec(op, &ss, opts)
 
 	return &valueSpec[T]{ss}
 }
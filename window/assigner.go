@@ -0,0 +1,83 @@
+package window
+
+import (
+	"fmt"
+	"time"
+)
+
+// An Assigner decides which windows an event timestamp belongs to. Use
+// [Tumbling], [Sliding], or [Session] to create one.
+type Assigner interface {
+	assign(ts time.Time) []bounds
+	isSession() bool
+}
+
+// Tumbling windows are fixed-size, non-overlapping windows aligned to the Unix
+// epoch. Every event belongs to exactly one window.
+func Tumbling(size time.Duration) Assigner {
+	if size <= 0 {
+		panic(fmt.Sprintf("tumbling window size must be positive, got %v", size))
+	}
+	return slidingAssigner{size: size, slide: size}
+}
+
+// Sliding windows are fixed-size windows that start every slide interval,
+// aligned to the Unix epoch. When slide is smaller than size, an event belongs
+// to several overlapping windows.
+func Sliding(size, slide time.Duration) Assigner {
+	if size <= 0 || slide <= 0 {
+		panic(fmt.Sprintf("sliding window size and slide must be positive, got %v and %v", size, slide))
+	}
+	return slidingAssigner{size: size, slide: slide}
+}
+
+// Session windows group events separated by less than the gap. A session
+// closes once the watermark passes the last event's timestamp plus the gap.
+func Session(gap time.Duration) Assigner {
+	if gap <= 0 {
+		panic(fmt.Sprintf("session window gap must be positive, got %v", gap))
+	}
+	return sessionAssigner{gap: gap}
+}
+
+// bounds is the half-open interval [start, end) covered by a window.
+type bounds struct {
+	start time.Time
+	end   time.Time
+}
+
+type slidingAssigner struct {
+	size  time.Duration
+	slide time.Duration
+}
+
+func (a slidingAssigner) assign(ts time.Time) []bounds {
+	nanos := ts.UnixNano()
+	slide := int64(a.slide)
+	lastStart := nanos - ((nanos%slide)+slide)%slide
+
+	var windows []bounds
+	for start := lastStart; start > nanos-int64(a.size); start -= slide {
+		windows = append(windows, bounds{
+			start: time.Unix(0, start).UTC(),
+			end:   time.Unix(0, start).UTC().Add(a.size),
+		})
+	}
+	return windows
+}
+
+func (a slidingAssigner) isSession() bool {
+	return false
+}
+
+type sessionAssigner struct {
+	gap time.Duration
+}
+
+func (a sessionAssigner) assign(ts time.Time) []bounds {
+	return []bounds{{start: ts, end: ts.Add(a.gap)}}
+}
+
+func (a sessionAssigner) isSession() bool {
+	return true
+}
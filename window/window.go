@@ -0,0 +1,228 @@
+// The window package groups keyed events into event-time windows and fires an
+// aggregated result for each window once the watermark passes its end.
+package window
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+
+	"reduction.dev/reduction-go/rxn"
+	"reduction.dev/reduction-go/topology"
+)
+
+// Aggregator folds event values of type T into an accumulator of type A. The
+// zero value of A is the accumulator for an empty window.
+type Aggregator[T, A any] interface {
+	// Add returns the accumulator after including value.
+	Add(acc A, value T) A
+	// Merge combines two accumulators. Session windows call Merge when an event
+	// bridges the gap between two sessions.
+	Merge(a, b A) A
+}
+
+// Params configures a window [Spec].
+type Params[T, A any] struct {
+	// Assigner decides which windows an event belongs to.
+	Assigner Assigner
+	// Aggregator accumulates values for each window.
+	Aggregator Aggregator[T, A]
+	// Codec serializes the accumulator for storage.
+	Codec rxn.ValueCodec[A]
+	// AllowedLateness keeps a window's state after the watermark passes its end
+	// so that late events can still update it. Each late update fires the window
+	// again. Events arriving after the window end plus the allowed lateness are
+	// dropped.
+	AllowedLateness time.Duration
+}
+
+// Result is the aggregated value of a window that fired.
+type Result[A any] struct {
+	Start time.Time
+	End   time.Time
+	Value A
+}
+
+// Spec manages windows for a keyed operator. Call [Spec.Add] from the
+// handler's OnEvent and [Spec.OnTimerExpired] from the handler's
+// OnTimerExpired.
+type Spec[T, A any] struct {
+	assigner   Assigner
+	aggregator Aggregator[T, A]
+	lateness   time.Duration
+	state      rxn.MapSpec[int64, entry[A]]
+}
+
+// NewSpec creates a window [Spec], registering its state with the provided
+// [topology.Operator] under id.
+func NewSpec[T, A any](op *topology.Operator, id string, params *Params[T, A]) *Spec[T, A] {
+	return &Spec[T, A]{
+		assigner:   params.Assigner,
+		aggregator: params.Aggregator,
+		lateness:   params.AllowedLateness,
+		state:      topology.NewMapSpec(op, id, entryCodec[A]{params.Codec}),
+	}
+}
+
+// Add includes the value in every window the timestamp belongs to and sets the
+// timers needed to fire and clean up those windows. It returns false if the
+// value was dropped because all of its windows are past their allowed lateness.
+func (s *Spec[T, A]) Add(subject rxn.Subject, timestamp time.Time, value T) bool {
+	state := s.state.StateFor(subject)
+	watermark := subject.Watermark()
+
+	var added bool
+	for _, b := range s.assigner.assign(timestamp) {
+		if !b.end.Add(s.lateness).After(watermark) {
+			continue
+		}
+		added = true
+
+		var current entry[A]
+		if s.assigner.isSession() {
+			current = s.mergeSessions(state, &b)
+			s.setTimers(subject, b.end)
+		} else if existing, ok := state.Get(b.start.UnixNano()); ok {
+			current = existing
+			if !current.end.After(watermark) {
+				// The window already fired so schedule it to fire again with the update.
+				subject.SetTimer(current.end)
+			}
+		} else {
+			current = entry[A]{end: b.end}
+			s.setTimers(subject, b.end)
+		}
+
+		current.acc = s.aggregator.Add(current.acc, value)
+		current.dirty = true
+		state.Set(b.start.UnixNano(), current)
+	}
+	return added
+}
+
+// mergeSessions removes every session overlapping b from state, extends b to
+// cover them, and returns an entry holding their combined accumulator.
+func (s *Spec[T, A]) mergeSessions(state rxn.MapState[int64, entry[A]], b *bounds) entry[A] {
+	var overlapping []int64
+	for start, e := range state.All() {
+		if start < b.end.UnixNano() && b.start.UnixNano() < e.end.UnixNano() {
+			overlapping = append(overlapping, start)
+		}
+	}
+	slices.Sort(overlapping)
+
+	var acc A
+	for i, start := range overlapping {
+		e, _ := state.Get(start)
+		if i == 0 {
+			acc = e.acc
+		} else {
+			acc = s.aggregator.Merge(acc, e.acc)
+		}
+		if start < b.start.UnixNano() {
+			b.start = time.Unix(0, start).UTC()
+		}
+		if e.end.After(b.end) {
+			b.end = e.end
+		}
+		state.Delete(start)
+	}
+	return entry[A]{end: b.end, acc: acc}
+}
+
+// OnTimerExpired fires every window that ended at or before the timer and has
+// changed since it last fired. Windows past their allowed lateness are removed.
+// Results are ordered by window start.
+func (s *Spec[T, A]) OnTimerExpired(subject rxn.Subject, timer time.Time) []Result[A] {
+	state := s.state.StateFor(subject)
+
+	var starts []int64
+	for start, e := range state.All() {
+		if !e.end.After(timer) {
+			starts = append(starts, start)
+		}
+	}
+	slices.Sort(starts)
+
+	var results []Result[A]
+	for _, start := range starts {
+		e, _ := state.Get(start)
+		if e.dirty {
+			results = append(results, Result[A]{
+				Start: time.Unix(0, start).UTC(),
+				End:   e.end,
+				Value: e.acc,
+			})
+			e.dirty = false
+			state.Set(start, e)
+		}
+		if !e.end.Add(s.lateness).After(timer) {
+			state.Delete(start)
+		}
+	}
+	return results
+}
+
+// setTimers registers the timer that fires a window and, when there is allowed
+// lateness, the timer that cleans it up.
+func (s *Spec[T, A]) setTimers(subject rxn.Subject, end time.Time) {
+	subject.SetTimer(end)
+	if s.lateness > 0 {
+		subject.SetTimer(end.Add(s.lateness))
+	}
+}
+
+// entry is the stored state of a single window, keyed by its start time.
+type entry[A any] struct {
+	end   time.Time
+	dirty bool
+	acc   A
+}
+
+// entryCodec encodes window start times as order-preserving big-endian keys so
+// that a scan returns windows in time order. Values are the window end, the
+// dirty flag, and the encoded accumulator.
+type entryCodec[A any] struct {
+	acc rxn.ValueCodec[A]
+}
+
+func (c entryCodec[A]) EncodeKey(start int64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, uint64(start)^(1<<63)), nil
+}
+
+func (c entryCodec[A]) DecodeKey(b []byte) (int64, error) {
+	if len(b) != 8 {
+		return 0, fmt.Errorf("invalid window key length %d", len(b))
+	}
+	return int64(binary.BigEndian.Uint64(b) ^ (1 << 63)), nil
+}
+
+func (c entryCodec[A]) EncodeValue(e entry[A]) ([]byte, error) {
+	acc, err := c.acc.Encode(e.acc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode window accumulator: %w", err)
+	}
+	b := binary.BigEndian.AppendUint64(make([]byte, 0, 9+len(acc)), uint64(e.end.UnixNano()))
+	var dirty byte
+	if e.dirty {
+		dirty = 1
+	}
+	b = append(b, dirty)
+	return append(b, acc...), nil
+}
+
+func (c entryCodec[A]) DecodeValue(b []byte) (entry[A], error) {
+	if len(b) < 9 {
+		return entry[A]{}, fmt.Errorf("invalid window value length %d", len(b))
+	}
+	acc, err := c.acc.Decode(b[9:])
+	if err != nil {
+		return entry[A]{}, fmt.Errorf("failed to decode window accumulator: %w", err)
+	}
+	return entry[A]{
+		end:   time.Unix(0, int64(binary.BigEndian.Uint64(b))).UTC(),
+		dirty: b[8] == 1,
+		acc:   acc,
+	}, nil
+}
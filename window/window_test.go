@@ -0,0 +1,276 @@
+package window_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reduction.dev/reduction-go/connectors/embedded"
+	"reduction.dev/reduction-go/connectors/memory"
+	"reduction.dev/reduction-go/connectors/stdio"
+	"reduction.dev/reduction-go/internal"
+	"reduction.dev/reduction-go/rxn"
+	"reduction.dev/reduction-go/topology"
+	"reduction.dev/reduction-go/window"
+	"reduction.dev/reduction-protocol/handlerpb"
+)
+
+func TestTumblingWindow(t *testing.T) {
+	handler, sink := setupWindowJob(t, &window.Params[int, int]{
+		Assigner: window.Tumbling(5 * time.Minute),
+	})
+
+	_, err := handler.ProcessEventBatch(context.Background(), &handlerpb.ProcessEventBatchRequest{
+		Events: []*handlerpb.Event{
+			keyedEvent("user", minutes(1)),
+			keyedEvent("user", minutes(2)),
+			keyedEvent("user", minutes(6)),
+			timerExpired("user", minutes(5)),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []window.Result[int]{{
+		Start: minutes(0),
+		End:   minutes(5),
+		Value: 2,
+	}}, sink.Records)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	handler, sink := setupWindowJob(t, &window.Params[int, int]{
+		Assigner: window.Sliding(10*time.Minute, 5*time.Minute),
+	})
+
+	_, err := handler.ProcessEventBatch(context.Background(), &handlerpb.ProcessEventBatchRequest{
+		Events: []*handlerpb.Event{
+			keyedEvent("user", minutes(3)),
+			keyedEvent("user", minutes(7)),
+			timerExpired("user", minutes(10)),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []window.Result[int]{{
+		Start: minutes(-5),
+		End:   minutes(5),
+		Value: 1,
+	}, {
+		Start: minutes(0),
+		End:   minutes(10),
+		Value: 2,
+	}}, sink.Records)
+}
+
+func TestSessionWindow_MergesBridgedSessions(t *testing.T) {
+	handler, sink := setupWindowJob(t, &window.Params[int, int]{
+		Assigner: window.Session(5 * time.Minute),
+	})
+
+	_, err := handler.ProcessEventBatch(context.Background(), &handlerpb.ProcessEventBatchRequest{
+		Events: []*handlerpb.Event{
+			keyedEvent("user", minutes(0)),
+			keyedEvent("user", minutes(8)),
+			keyedEvent("user", minutes(4)), // bridges the first two sessions
+			keyedEvent("user", minutes(20)),
+			timerExpired("user", minutes(13)),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []window.Result[int]{{
+		Start: minutes(0),
+		End:   minutes(13),
+		Value: 3,
+	}}, sink.Records)
+}
+
+func TestWindow_DropsEventsPastAllowedLateness(t *testing.T) {
+	var accepted []bool
+	job := &topology.Job{}
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{})
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			spec := window.NewSpec(op, "counts", &window.Params[int, int]{
+				Assigner:        window.Tumbling(5 * time.Minute),
+				Aggregator:      sum{},
+				Codec:           rxn.ScalarValueCodec[int]{},
+				AllowedLateness: time.Minute,
+			})
+			return &handler{onEvent: func(subject rxn.Subject, event rxn.KeyedEvent) {
+				accepted = append(accepted, spec.Add(subject, event.Timestamp, 1))
+			}}
+		},
+	})
+	source.Connect(operator)
+	synth, err := job.Synthesize()
+	require.NoError(t, err)
+
+	_, err = synth.Handler.ProcessEventBatch(context.Background(), &handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(minutes(5).Add(30 * time.Second)),
+		Events: []*handlerpb.Event{
+			keyedEvent("user", minutes(1)), // late but within allowed lateness
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = synth.Handler.ProcessEventBatch(context.Background(), &handlerpb.ProcessEventBatchRequest{
+		Watermark: timestamppb.New(minutes(6)),
+		Events: []*handlerpb.Event{
+			keyedEvent("user", minutes(1)), // past allowed lateness
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []bool{true, false}, accepted)
+}
+
+func TestWindow_RefiresLateUpdatesAndCleansUpState(t *testing.T) {
+	job := &topology.Job{}
+	sink := stdio.NewSink(job, "sink")
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{
+		KeyEvent: func(ctx context.Context, record []byte) ([]internal.KeyedEvent, error) {
+			var key string
+			var n int
+			if _, err := fmt.Sscanf(string(record), "%s %d", &key, &n); err != nil {
+				return nil, err
+			}
+			return []internal.KeyedEvent{{Key: []byte(key), Timestamp: minutes(n)}}, nil
+		},
+	})
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			spec := window.NewSpec(op, "counts", &window.Params[int, int]{
+				Assigner:        window.Tumbling(5 * time.Minute),
+				Aggregator:      sum{},
+				Codec:           rxn.ScalarValueCodec[int]{},
+				AllowedLateness: time.Minute,
+			})
+			return &handler{
+				onEvent: func(subject rxn.Subject, event rxn.KeyedEvent) {
+					spec.Add(subject, event.Timestamp, 1)
+				},
+				onTimerExpired: func(ctx context.Context, subject rxn.Subject, timer time.Time) {
+					for _, result := range spec.OnTimerExpired(subject, timer) {
+						sink.Collect(ctx, stdio.Event(fmt.Sprintf("%s-%s: %d",
+							result.Start.Format(time.TimeOnly), result.End.Format(time.TimeOnly), result.Value)))
+					}
+				},
+			}
+		},
+	})
+	source.Connect(operator)
+	operator.Connect(sink)
+
+	tr := job.NewTestRun()
+	tr.AddRecord([]byte("user 1"))
+	tr.AddRecord([]byte("user 2"))
+	tr.AddWatermarkAt(minutes(5).Add(30 * time.Second))
+	tr.Snapshot()
+	tr.AddRecord([]byte("user 3")) // late but within allowed lateness
+	tr.AddWatermarkAt(minutes(5).Add(45 * time.Second))
+	tr.Snapshot()
+	tr.AddWatermarkAt(minutes(6))
+	tr.Snapshot()
+	require.NoError(t, tr.RunLocal())
+
+	snapshots := tr.Snapshots()
+	require.Len(t, snapshots, 3)
+	assert.Equal(t, [][]byte{[]byte("00:00:00-00:05:00: 2")}, snapshots[0].SinkValues["sink"])
+	assert.Equal(t, [][]byte{[]byte("00:00:00-00:05:00: 3")}, snapshots[1].SinkValues["sink"],
+		"the late update should fire the window again before its allowed lateness passes")
+	assert.Empty(t, snapshots[2].SinkValues["sink"], "an unchanged window should not fire when it is removed")
+
+	assert.Len(t, snapshots[1].State["user"]["counts"], 1, "the window should be kept until its allowed lateness passes")
+	assert.Empty(t, snapshots[2].State["user"]["counts"], "the window should be removed at its end plus allowed lateness")
+}
+
+type sum struct{}
+
+func (sum) Add(acc int, value int) int {
+	return acc + value
+}
+
+func (sum) Merge(a, b int) int {
+	return a + b
+}
+
+// setupWindowJob creates a job where every event adds 1 to the windows
+// configured by params and fired windows are collected in a memory sink.
+func setupWindowJob(t *testing.T, params *window.Params[int, int]) (*internal.SynthesizedHandler, *memory.Sink[window.Result[int]]) {
+	t.Helper()
+
+	params.Aggregator = sum{}
+	params.Codec = rxn.ScalarValueCodec[int]{}
+
+	job := &topology.Job{}
+	sink := memory.NewSink[window.Result[int]](job, "sink")
+	source := embedded.NewSource(job, "source", &embedded.SourceParams{})
+	operator := topology.NewOperator(job, "operator", &topology.OperatorParams{
+		Handler: func(op *topology.Operator) rxn.OperatorHandler {
+			spec := window.NewSpec(op, "counts", params)
+			return &handler{
+				onEvent: func(subject rxn.Subject, event rxn.KeyedEvent) {
+					spec.Add(subject, event.Timestamp, 1)
+				},
+				onTimerExpired: func(ctx context.Context, subject rxn.Subject, timer time.Time) {
+					for _, result := range spec.OnTimerExpired(subject, timer) {
+						sink.Collect(ctx, result)
+					}
+				},
+			}
+		},
+	})
+	source.Connect(operator)
+
+	synth, err := job.Synthesize()
+	require.NoError(t, err)
+	return synth.Handler, sink
+}
+
+type handler struct {
+	onEvent        func(subject rxn.Subject, event rxn.KeyedEvent)
+	onTimerExpired func(ctx context.Context, subject rxn.Subject, timer time.Time)
+}
+
+func (h *handler) OnEvent(ctx context.Context, subject rxn.Subject, event rxn.KeyedEvent) error {
+	h.onEvent(subject, event)
+	return nil
+}
+
+func (h *handler) OnTimerExpired(ctx context.Context, subject rxn.Subject, timer time.Time) error {
+	if h.onTimerExpired != nil {
+		h.onTimerExpired(ctx, subject, timer)
+	}
+	return nil
+}
+
+func minutes(n int) time.Time {
+	return time.Unix(0, 0).UTC().Add(time.Duration(n) * time.Minute)
+}
+
+func keyedEvent(key string, ts time.Time) *handlerpb.Event {
+	return &handlerpb.Event{
+		Event: &handlerpb.Event_KeyedEvent{
+			KeyedEvent: &handlerpb.KeyedEvent{
+				Key:       []byte(key),
+				Timestamp: timestamppb.New(ts),
+			},
+		},
+	}
+}
+
+func timerExpired(key string, ts time.Time) *handlerpb.Event {
+	return &handlerpb.Event{
+		Event: &handlerpb.Event_TimerExpired{
+			TimerExpired: &handlerpb.TimerExpired{
+				Key:       []byte(key),
+				Timestamp: timestamppb.New(ts),
+			},
+		},
+	}
+}